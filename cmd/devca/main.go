@@ -0,0 +1,45 @@
+// Command devca writes a throwaway CA and per-service certificates for trying
+// gRPC TLS and mTLS locally:
+//
+//	go run ./cmd/devca -out .certs
+//
+// Each service gets <name>.pem and <name>-key.pem, valid for both server and
+// client use, with the service name and -hosts as SANs.
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"comfy-service-tests/internal/grpctls"
+)
+
+func main() {
+	out := flag.String("out", ".certs", "output directory")
+	names := flag.String("names", "gateway,orchestrator,stage-sampler", "comma-separated service names to issue certificates for")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma-separated extra SANs added to every certificate")
+	validity := flag.Duration("validity", 30*24*time.Hour, "certificate lifetime")
+	flag.Parse()
+
+	ca, err := grpctls.NewDevCA("comfy-service dev CA", *validity)
+	if err != nil {
+		log.Fatalf("failed to create CA: %v", err)
+	}
+	services := splitList(*names)
+	if err := ca.WriteFiles(*out, services, splitList(*hosts), *validity); err != nil {
+		log.Fatalf("failed to write certificates: %v", err)
+	}
+	log.Printf("wrote %s/ca.pem and certificates for %s", *out, strings.Join(services, ", "))
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
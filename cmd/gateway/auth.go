@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"comfy-service-tests/internal/auth"
+	"comfy-service-tests/internal/orchestrator"
+)
+
+const (
+	defaultTokenTTL = time.Hour
+	maxTokenTTL     = 24 * time.Hour
+)
+
+// loadAuthenticator reads GATEWAY_API_KEYS_FILE and GATEWAY_TOKEN_SECRET.
+// With neither set, authentication is disabled.
+func loadAuthenticator() (*auth.Authenticator, error) {
+	var keys []auth.Key
+	if path := os.Getenv("GATEWAY_API_KEYS_FILE"); path != "" {
+		loaded, err := auth.LoadKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = loaded
+	}
+	secret := []byte(os.Getenv("GATEWAY_TOKEN_SECRET"))
+	if len(secret) > 0 && len(secret) < auth.MinSecretLength {
+		return nil, errTokenSecretTooShort
+	}
+	return auth.New(keys, secret), nil
+}
+
+var errTokenSecretTooShort = fmt.Errorf("GATEWAY_TOKEN_SECRET must be at least %d bytes", auth.MinSecretLength)
+
+// requiredScope maps gateway routes to the scope they need. Submissions need
+// submit, metrics need admin, minting a token only needs a valid credential,
+// and everything else needs read. CORS preflights and the health probes are
+// public.
+func requiredScope(r *http.Request) (auth.Scope, bool) {
+	if r.Method == http.MethodOptions || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+		return "", false
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	switch {
+	case path == "/metrics":
+		return auth.ScopeAdmin, true
+	case r.URL.Path == "/v1/auth/token":
+		return "", true
+	case r.Method == http.MethodPost && (r.URL.Path == "/v1/workflows" || path == "/prompt"):
+		return auth.ScopeSubmit, true
+	}
+	return auth.ScopeRead, true
+}
+
+type tokenRequest struct {
+	Subject    string   `json:"subject"`
+	Scopes     []string `json:"scopes"`
+	TTLSeconds int64    `json:"ttl_seconds"`
+}
+
+type tokenResponse struct {
+	Token     string       `json:"token"`
+	TokenType string       `json:"token_type"`
+	Subject   string       `json:"subject"`
+	Scopes    []auth.Scope `json:"scopes"`
+	ExpiresAt int64        `json:"expires_at"`
+}
+
+// handleToken serves POST /v1/auth/token. Callers may mint tokens for
+// themselves with a subset of their own scopes; admins may name any subject
+// and scope.
+func (g *gateway) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !g.auth.TokensEnabled() {
+		http.Error(w, "token issuing is not configured", http.StatusNotImplemented)
+		return
+	}
+	caller, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req tokenRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "invalid token request", http.StatusBadRequest)
+			return
+		}
+	}
+	subject := caller.Subject
+	if req.Subject != "" && req.Subject != caller.Subject {
+		if !caller.Allows(auth.ScopeAdmin) {
+			http.Error(w, "only admins may issue tokens for other subjects", http.StatusForbidden)
+			return
+		}
+		subject = req.Subject
+	}
+	scopes := caller.Scopes
+	if len(req.Scopes) > 0 {
+		scopes = make([]auth.Scope, 0, len(req.Scopes))
+		for _, name := range req.Scopes {
+			scope, err := auth.ParseScope(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !caller.Allows(scope) {
+				http.Error(w, "cannot grant scope "+string(scope), http.StatusForbidden)
+				return
+			}
+			scopes = append(scopes, scope)
+		}
+	}
+	ttl := defaultTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxTokenTTL {
+		ttl = maxTokenTTL
+	}
+	// A token cannot outlive the token used to request it.
+	if !caller.ExpiresAt.IsZero() {
+		if remaining := time.Until(caller.ExpiresAt); remaining < ttl {
+			ttl = remaining
+		}
+	}
+
+	// The token keeps the caller's job quota, whoever it is issued for.
+	grant := auth.Identity{Subject: subject, Scopes: scopes, MaxActiveJobs: caller.MaxActiveJobs}
+	token, expires, err := g.auth.IssueToken(grant, ttl)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "issue token failed", "err", err)
+		http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "token issued", "issuer", caller.Subject, "subject", subject, "scopes", scopes, "expires_at", expires)
+	writeJSON(w, http.StatusOK, tokenResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		Subject:   subject,
+		Scopes:    scopes,
+		ExpiresAt: expires.Unix(),
+	})
+}
+
+// withSubmitter records the caller in workflow metadata so the orchestrator
+// knows who submitted each job: the authenticated subject, or "ip:<addr>"
+// for anonymous callers when authentication is disabled.
+func withSubmitter(r *http.Request, metadata map[string]string) map[string]string {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[orchestrator.MetadataSubmittedBy] = callerKey(r)
+	if id, ok := auth.FromContext(r.Context()); ok {
+		metadata[orchestrator.MetadataAuthMethod] = id.Method
+	} else {
+		metadata[orchestrator.MetadataAuthMethod] = "anonymous"
+	}
+	return metadata
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/jobid"
+	"comfy-service-tests/internal/logging"
+	"comfy-service-tests/internal/orchestrator"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+
+	"golang.org/x/net/websocket"
+)
+
+// maxComfyPrompts bounds the submissions remembered for /queue and /history.
+const maxComfyPrompts = 1000
+
+// comfyCompat maps ComfyUI's HTTP API (/prompt, /queue, /history, /view,
+// /object_info and /ws) onto the orchestrator, so stock ComfyUI clients and
+// scripts can target the gateway. ComfyUI's prompt_id is our job id.
+type comfyCompat struct {
+	g *gateway
+
+	mu      sync.Mutex
+	number  int
+	prompts map[string]*comfyPrompt
+	order   []string
+	sockets map[*comfySocket]struct{}
+}
+
+// comfyPrompt remembers what a /prompt caller submitted, for queue and
+// history entries and for routing websocket events back to the client.
+// owner is the submitting caller's key; only that caller sees the prompt.
+type comfyPrompt struct {
+	number      int
+	clientID    string
+	owner       string
+	prompt      json.RawMessage
+	outputNodes []string
+}
+
+func newComfyCompat(g *gateway) *comfyCompat {
+	return &comfyCompat{
+		g:       g,
+		prompts: make(map[string]*comfyPrompt),
+		sockets: make(map[*comfySocket]struct{}),
+	}
+}
+
+// register mounts the endpoints at the root and under /api, where newer
+// ComfyUI frontends expect them.
+func (c *comfyCompat) register(mux *http.ServeMux) {
+	for _, prefix := range []string{"", "/api"} {
+		mux.HandleFunc(prefix+"/prompt", c.handlePrompt)
+		mux.HandleFunc(prefix+"/queue", c.handleQueue)
+		mux.HandleFunc(prefix+"/history", c.handleHistory)
+		mux.HandleFunc(prefix+"/history/", c.handleHistory)
+		mux.HandleFunc(prefix+"/view", c.handleView)
+		mux.HandleFunc(prefix+"/object_info", c.handleObjectInfo)
+		mux.HandleFunc(prefix+"/object_info/", c.handleObjectInfo)
+		mux.Handle(prefix+"/ws", longLived(websocket.Server{Handler: c.serveWS, Handshake: c.checkWSHandshake}))
+	}
+}
+
+// comfyEndpoints are the compat paths register mounts, without the prefix.
+var comfyEndpoints = map[string]bool{"prompt": true, "queue": true, "history": true, "view": true, "object_info": true, "ws": true}
+
+// comfyRouteLabel is the metrics route of a compat path, with the prompt id
+// of /history/<id> and the node of /object_info/<node> collapsed. ok is false
+// for paths outside the compat API.
+func comfyRouteLabel(urlPath string) (label string, ok bool) {
+	prefix := ""
+	if rest, found := strings.CutPrefix(urlPath, "/api/"); found {
+		prefix, urlPath = "/api", "/"+rest
+	}
+	name, item, nested := strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	switch {
+	case !comfyEndpoints[name]:
+		return "", false
+	case !nested || item == "":
+		return prefix + "/" + name, true
+	case strings.Contains(item, "/"):
+		return "", false
+	case name == "history":
+		return prefix + "/history/:id", true
+	case name == "object_info":
+		return prefix + "/object_info/:node", true
+	}
+	return "", false
+}
+
+type comfyPromptRequest struct {
+	Prompt    json.RawMessage `json:"prompt"`
+	ClientID  string          `json:"client_id"`
+	ExtraData struct {
+		ExtraPNGInfo struct {
+			Workflow json.RawMessage `json:"workflow"`
+		} `json:"extra_pnginfo"`
+	} `json:"extra_data"`
+}
+
+type comfyPromptResponse struct {
+	PromptID   string         `json:"prompt_id"`
+	Number     int            `json:"number"`
+	NodeErrors map[string]any `json:"node_errors"`
+}
+
+type comfyErrorBody struct {
+	Type      string         `json:"type"`
+	Message   string         `json:"message"`
+	Details   string         `json:"details"`
+	ExtraInfo map[string]any `json:"extra_info"`
+}
+
+type comfyErrorResponse struct {
+	Error      comfyErrorBody `json:"error"`
+	NodeErrors map[string]any `json:"node_errors"`
+}
+
+func writeComfyError(w http.ResponseWriter, status int, kind, message string) {
+	writeJSON(w, status, comfyErrorResponse{
+		Error:      comfyErrorBody{Type: kind, Message: message, ExtraInfo: map[string]any{}},
+		NodeErrors: map[string]any{},
+	})
+}
+
+func (c *comfyCompat) handlePrompt(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		remaining, err := c.queueRemaining(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "queue status failed", "err", err)
+			http.Error(w, "failed to read queue", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"exec_info": map[string]int{"queue_remaining": remaining}})
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	defer r.Body.Close()
+	payload, err := io.ReadAll(io.LimitReader(r.Body, 1<<20+1))
+	if err != nil || len(payload) > 1<<20 {
+		writeComfyError(w, http.StatusBadRequest, "invalid_prompt", "failed to read prompt")
+		return
+	}
+	var req comfyPromptRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		writeComfyError(w, http.StatusBadRequest, "invalid_prompt", "invalid json: "+err.Error())
+		return
+	}
+	if format, err := orchestrator.DetectWorkflowFormat(req.Prompt); err != nil || format != orchestrator.FormatComfyUIAPI {
+		writeComfyError(w, http.StatusBadRequest, "invalid_prompt", "prompt must be an API-format graph")
+		return
+	}
+
+	if ok, wait := c.g.admitSubmission(r); !ok {
+		setRetryAfter(w, wait)
+		writeComfyError(w, http.StatusTooManyRequests, "rate_limited", "rate limit exceeded")
+		return
+	}
+
+	sessionID := req.ClientID
+	if !validClientID(sessionID) {
+		sessionID = ensureClientID(w, r)
+	}
+	principal := sessionPrincipal(r)
+	if err := c.g.sessions.check(sessionID, principal); err != nil {
+		writeComfyError(w, http.StatusForbidden, "session_forbidden", err.Error())
+		return
+	}
+
+	metadata := map[string]string{}
+	if req.ClientID != "" {
+		metadata["client_id"] = req.ClientID
+	}
+	if workflow := req.ExtraData.ExtraPNGInfo.Workflow; len(workflow) > 0 && string(workflow) != "null" {
+		metadata["workflow"] = string(workflow)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	execResp, err := c.g.client.ExecuteWorkflow(ctx, &orchestratorv1.ExecuteWorkflowRequest{
+		Graph: &orchestratorv1.WorkflowGraph{
+			Format:       orchestrator.FormatComfyUIAPI,
+			WorkflowJson: string(req.Prompt),
+		},
+		Metadata: c.g.withQuota(r, withSubmitter(r, metadata)),
+	})
+	if message, ok := quotaExceeded(err); ok {
+		setRetryAfter(w, quotaRetryAfter)
+		writeComfyError(w, http.StatusTooManyRequests, "quota_exceeded", message)
+		return
+	}
+	if backendUnavailable(err) {
+		slog.WarnContext(ctx, "submit prompt refused", "err", err)
+		setRetryAfter(w, unavailableRetryAfter)
+		writeComfyError(w, http.StatusServiceUnavailable, "backend_unavailable", "workflow backend unavailable")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "submit prompt failed", "err", err)
+		writeComfyError(w, http.StatusBadGateway, "prompt_submit_failed", "failed to submit prompt")
+		return
+	}
+
+	id := execResp.WorkflowId
+	number := c.remember(id, req.ClientID, callerKey(r), req.Prompt)
+	if err := c.g.sessions.record(sessionID, principal, id); err != nil {
+		slog.WarnContext(ctx, "prompt not recorded in session", "client_id", sessionID, "err", err)
+	}
+	slog.InfoContext(logging.WithJob(ctx, id), "comfy prompt submitted", "client_id", req.ClientID, "number", number)
+
+	c.notifySockets(req.ClientID, id)
+	writeJSON(w, http.StatusOK, comfyPromptResponse{PromptID: id, Number: number, NodeErrors: map[string]any{}})
+}
+
+func (c *comfyCompat) remember(id, clientID, owner string, prompt json.RawMessage) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.number++
+	c.prompts[id] = &comfyPrompt{
+		number:      c.number,
+		clientID:    clientID,
+		owner:       owner,
+		prompt:      prompt,
+		outputNodes: outputNodes(prompt),
+	}
+	c.order = append(c.order, id)
+	if len(c.order) > maxComfyPrompts {
+		delete(c.prompts, c.order[0])
+		c.order = c.order[1:]
+	}
+	return c.number
+}
+
+func (c *comfyCompat) lookup(id string) *comfyPrompt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.prompts[id]
+}
+
+// visibleTo reports whether caller may see job id in /queue and /history.
+// Prompts belong to the caller that posted them; other jobs to the submitter
+// the orchestrator recorded, when the listing carries one.
+func (c *comfyCompat) visibleTo(id, submittedBy, caller string) bool {
+	if submitted := c.lookup(id); submitted != nil {
+		return submitted.owner == caller
+	}
+	return submittedBy != "" && submittedBy == caller
+}
+
+// outputNodes returns the ids of image-saving nodes in an API-format prompt.
+func outputNodes(prompt json.RawMessage) []string {
+	var nodes map[string]struct {
+		ClassType string `json:"class_type"`
+	}
+	if err := json.Unmarshal(prompt, &nodes); err != nil {
+		return nil
+	}
+	var ids []string
+	for id, node := range nodes {
+		if node.ClassType == "SaveImage" || node.ClassType == "PreviewImage" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// queueEntry renders ComfyUI's [number, prompt_id, prompt, extra_data, outputs_to_execute] tuple.
+func (c *comfyCompat) queueEntry(id string) []any {
+	entry := []any{0, id, map[string]any{}, map[string]any{}, []string{}}
+	if submitted := c.lookup(id); submitted != nil {
+		entry[0] = submitted.number
+		entry[2] = submitted.prompt
+		entry[3] = map[string]string{"client_id": submitted.clientID}
+		if submitted.outputNodes != nil {
+			entry[4] = submitted.outputNodes
+		}
+	}
+	return entry
+}
+
+// listByState returns jobs in state, oldest first.
+func (c *comfyCompat) listByState(ctx context.Context, state string, limit int32) ([]*orchestratorv1.WorkflowSummary, error) {
+	resp, err := c.g.client.ListWorkflows(ctx, &orchestratorv1.ListWorkflowsRequest{State: state, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	workflows := resp.Workflows
+	for i, j := 0, len(workflows)-1; i < j; i, j = i+1, j-1 {
+		workflows[i], workflows[j] = workflows[j], workflows[i]
+	}
+	return workflows, nil
+}
+
+func (c *comfyCompat) queueRemaining(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	total := 0
+	for _, state := range []string{"queued", "running"} {
+		workflows, err := c.listByState(ctx, state, 500)
+		if err != nil {
+			return 0, err
+		}
+		total += len(workflows)
+	}
+	return total, nil
+}
+
+func (c *comfyCompat) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		// Jobs cannot be cancelled or removed from the orchestrator queue.
+		http.Error(w, "queue changes are not supported", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	caller := callerKey(r)
+	response := map[string][][]any{"queue_running": {}, "queue_pending": {}}
+	for state, key := range map[string]string{"running": "queue_running", "queued": "queue_pending"} {
+		workflows, err := c.listByState(ctx, state, 500)
+		if err != nil {
+			slog.ErrorContext(ctx, "list queue failed", "state", state, "err", err)
+			http.Error(w, "failed to read queue", http.StatusBadGateway)
+			return
+		}
+		for _, workflow := range workflows {
+			if c.visibleTo(workflow.WorkflowId, workflow.SubmittedBy, caller) {
+				response[key] = append(response[key], c.queueEntry(workflow.WorkflowId))
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+type comfyImage struct {
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"`
+}
+
+type comfyStatus struct {
+	StatusStr string  `json:"status_str"`
+	Completed bool    `json:"completed"`
+	Messages  [][]any `json:"messages"`
+}
+
+type comfyHistoryEntry struct {
+	Prompt  []any                              `json:"prompt"`
+	Outputs map[string]map[string][]comfyImage `json:"outputs"`
+	Status  comfyStatus                        `json:"status"`
+	Meta    map[string]map[string]string       `json:"meta"`
+}
+
+// historyEntry describes a finished job; running and queued jobs have none.
+func (c *comfyCompat) historyEntry(id, state, message string, submittedMs, completedMs int64, output *orchestratorv1.TensorRef) (comfyHistoryEntry, bool) {
+	if state != "completed" && state != "failed" {
+		return comfyHistoryEntry{}, false
+	}
+	entry := comfyHistoryEntry{
+		Prompt:  c.queueEntry(id),
+		Outputs: map[string]map[string][]comfyImage{},
+		Meta:    map[string]map[string]string{},
+		Status: comfyStatus{Messages: [][]any{
+			{"execution_start", map[string]any{"prompt_id": id, "timestamp": submittedMs}},
+		}},
+	}
+	if state == "failed" {
+		entry.Status.StatusStr = "error"
+		entry.Status.Messages = append(entry.Status.Messages, []any{"execution_error", map[string]any{
+			"prompt_id": id, "timestamp": completedMs, "exception_message": message, "exception_type": "StageError",
+		}})
+		return entry, true
+	}
+
+	entry.Status.StatusStr = "success"
+	entry.Status.Completed = true
+	entry.Status.Messages = append(entry.Status.Messages, []any{"execution_success", map[string]any{"prompt_id": id, "timestamp": completedMs}})
+	if image, ok := c.imageFor(id, output); ok {
+		node := c.outputNode(id)
+		entry.Outputs[node] = map[string][]comfyImage{"images": {image}}
+		entry.Meta[node] = map[string]string{"node_id": node, "display_node": node}
+	}
+	return entry, true
+}
+
+// outputNode names the node that produced a job's image; jobs not submitted
+// through /prompt report it under "0".
+func (c *comfyCompat) outputNode(id string) string {
+	if submitted := c.lookup(id); submitted != nil && len(submitted.outputNodes) > 0 {
+		return submitted.outputNodes[0]
+	}
+	return "0"
+}
+
+// imageFor turns an output ref into the filename/subfolder pair /view accepts.
+func (c *comfyCompat) imageFor(id string, output *orchestratorv1.TensorRef) (comfyImage, bool) {
+	key := id + "/output.png"
+	if output != nil {
+		_, resolved, err := artifacts.NewResolver(c.g.store).Resolve(output.GetUri())
+		if err != nil || !strings.HasPrefix(resolved, id+"/") {
+			return comfyImage{}, false
+		}
+		key = resolved
+	}
+	return comfyImage{Filename: path.Base(key), Subfolder: path.Dir(key), Type: "output"}, true
+}
+
+func (c *comfyCompat) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		http.Error(w, "history changes are not supported", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	caller := callerKey(r)
+	history := map[string]comfyHistoryEntry{}
+	_, rest, _ := strings.Cut(r.URL.Path, "/history")
+	if id := strings.TrimPrefix(rest, "/"); id != "" {
+		if !jobid.Valid(id) || !c.visibleTo(id, "", caller) {
+			writeJSON(w, http.StatusOK, history)
+			return
+		}
+		resp, err := c.g.client.GetWorkflowStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: id})
+		if err != nil {
+			slog.ErrorContext(ctx, "get status failed", "err", err)
+			http.Error(w, "failed to read history", http.StatusBadGateway)
+			return
+		}
+		timing := resp.GetTiming()
+		if entry, ok := c.historyEntry(id, resp.State, resp.Message, timing.GetSubmittedAtUnixMs(), timing.GetCompletedAtUnixMs(), resp.Output); ok {
+			history[id] = entry
+		}
+		writeJSON(w, http.StatusOK, history)
+		return
+	}
+
+	limit := 100
+	if maxItems, err := strconv.Atoi(r.URL.Query().Get("max_items")); err == nil && maxItems > 0 {
+		limit = maxItems
+	}
+	for _, state := range []string{"completed", "failed"} {
+		workflows, err := c.listByState(ctx, state, int32(limit))
+		if err != nil {
+			slog.ErrorContext(ctx, "list history failed", "err", err)
+			http.Error(w, "failed to read history", http.StatusBadGateway)
+			return
+		}
+		for _, workflow := range workflows {
+			if !c.visibleTo(workflow.WorkflowId, workflow.SubmittedBy, caller) {
+				continue
+			}
+			if entry, ok := c.historyEntry(workflow.WorkflowId, workflow.State, workflow.Message, workflow.SubmittedAtUnixMs, workflow.CompletedAtUnixMs, workflow.Output); ok {
+				history[workflow.WorkflowId] = entry
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// handleView serves /view?filename=&subfolder=<job-id>&type=output.
+func (c *comfyCompat) handleView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if kind := query.Get("type"); kind != "" && kind != "output" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	subfolder, filename := query.Get("subfolder"), query.Get("filename")
+	if !jobid.Valid(subfolder) || filename == "" || strings.ContainsAny(filename, `/\`) || filename == "." || filename == ".." {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	c.g.serveArtifact(logging.WithJob(r.Context(), subfolder), w, r, subfolder+"/"+filename, "")
+}
+
+type comfyNodeInfo struct {
+	Input        comfyNodeInputs `json:"input"`
+	Output       []string        `json:"output"`
+	OutputIsList []bool          `json:"output_is_list"`
+	OutputName   []string        `json:"output_name"`
+	Name         string          `json:"name"`
+	DisplayName  string          `json:"display_name"`
+	Description  string          `json:"description"`
+	Category     string          `json:"category"`
+	OutputNode   bool            `json:"output_node"`
+}
+
+type comfyNodeInputs struct {
+	Required map[string][]any `json:"required"`
+}
+
+// comfyWidgets describes the widget inputs the orchestrator reads, in
+// ComfyUI's [type, options] or [[choices]] form.
+var comfyWidgets = map[string]map[string][]any{
+	"CLIPTextEncode": {
+		"text": {"STRING", map[string]any{"multiline": true}},
+	},
+	"EmptyLatentImage": {
+		"width":      {"INT", map[string]any{"default": 512, "min": 64, "max": 4096, "step": 8}},
+		"height":     {"INT", map[string]any{"default": 512, "min": 64, "max": 4096, "step": 8}},
+		"batch_size": {"INT", map[string]any{"default": 1, "min": 1, "max": 1}},
+	},
+	"KSampler": {
+		"seed":         {"INT", map[string]any{"default": 0, "min": 0, "max": uint64(1<<64 - 1)}},
+		"steps":        {"INT", map[string]any{"default": 20, "min": 1, "max": 10000}},
+		"cfg":          {"FLOAT", map[string]any{"default": 8.0, "min": 0.0, "max": 100.0, "step": 0.1}},
+		"sampler_name": {[]string{"euler", "euler_ancestral", "ddim"}},
+		"scheduler":    {[]string{"normal", "karras"}},
+		"denoise":      {"FLOAT", map[string]any{"default": 1.0, "min": 0.0, "max": 1.0, "step": 0.01}},
+	},
+	"SaveImage": {
+		"filename_prefix": {"STRING", map[string]any{"default": "ComfyUI"}},
+		"format":          {[]string{"png", "jpeg", "webp"}},
+		"quality":         {"INT", map[string]any{"default": 90, "min": 1, "max": 100}},
+	},
+}
+
+func (c *comfyCompat) handleObjectInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	resp, err := c.g.client.ListNodes(ctx, &orchestratorv1.ListNodesRequest{})
+	if err != nil {
+		slog.ErrorContext(ctx, "list nodes failed", "err", err)
+		http.Error(w, "failed to load node catalog", http.StatusBadGateway)
+		return
+	}
+	checkpoints, err := listCheckpoints(c.g.checkpointsDir, c.g.minCheckpointBytes, c.g.maxCheckpointBytes)
+	if err != nil {
+		slog.WarnContext(ctx, "list checkpoints failed", "dir", c.g.checkpointsDir, "err", err)
+		checkpoints = []string{}
+	}
+
+	_, only, _ := strings.Cut(r.URL.Path, "/object_info")
+	only = strings.TrimPrefix(only, "/")
+	info := map[string]comfyNodeInfo{}
+	for _, node := range resp.Nodes {
+		if only != "" && node.Name != only {
+			continue
+		}
+		info[node.Name] = comfyNode(node, checkpoints)
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func comfyNode(node *orchestratorv1.NodeDefinition, checkpoints []string) comfyNodeInfo {
+	info := comfyNodeInfo{
+		Input:        comfyNodeInputs{Required: map[string][]any{}},
+		Output:       []string{},
+		OutputIsList: []bool{},
+		OutputName:   []string{},
+		Name:         node.Name,
+		DisplayName:  node.Name,
+		Category:     node.Category,
+		OutputNode:   node.Name == "SaveImage",
+	}
+	for name, kind := range node.Inputs {
+		info.Input.Required[name] = []any{kind}
+	}
+	for name, spec := range comfyWidgets[node.Name] {
+		info.Input.Required[name] = spec
+	}
+	if node.Name == "CheckpointLoaderSimple" {
+		info.Input.Required["ckpt_name"] = []any{checkpoints}
+	}
+	names := make([]string, 0, len(node.Outputs))
+	for name := range node.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		info.Output = append(info.Output, node.Outputs[name])
+		info.OutputIsList = append(info.OutputIsList, false)
+		info.OutputName = append(info.OutputName, name)
+	}
+	return info
+}
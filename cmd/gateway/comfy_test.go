@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPrompt = `{"prompt": {"3": {"class_type": "KSampler", "inputs": {}}, "9": {"class_type": "SaveImage", "inputs": {}}}}`
+
+func postPrompt(t *testing.T, mux http.Handler, subject string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, as(httptest.NewRequest(http.MethodPost, "/prompt", strings.NewReader(testPrompt)), subject))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("prompt as %s: status %d: %s", subject, rec.Code, rec.Body)
+	}
+	var resp comfyPromptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode prompt response: %v", err)
+	}
+	return resp.PromptID
+}
+
+func getJSON(t *testing.T, mux http.Handler, r *http.Request, v any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", r.URL.Path, rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: decode: %v", r.URL.Path, err)
+	}
+}
+
+func TestComfyQueueAndHistoryShowOnlyCallersJobs(t *testing.T) {
+	fake := &fakeOrchestrator{}
+	mux := http.NewServeMux()
+	newComfyCompat(newTestGateway(fake)).register(mux)
+
+	alicePrompt := postPrompt(t, mux, "alice")
+	bobPrompt := postPrompt(t, mux, "bob")
+	aliceWorkflow := fake.add("queued", "alice")
+
+	queueIDs := func(subject string) []string {
+		var queue map[string][][]any
+		getJSON(t, mux, as(httptest.NewRequest(http.MethodGet, "/api/queue", nil), subject), &queue)
+		var ids []string
+		for _, entry := range queue["queue_pending"] {
+			ids = append(ids, entry[1].(string))
+		}
+		return ids
+	}
+	if got := strings.Join(queueIDs("alice"), ","); got != alicePrompt+","+aliceWorkflow {
+		t.Fatalf("alice's queue = %s", got)
+	}
+	if got := strings.Join(queueIDs("bob"), ","); got != bobPrompt {
+		t.Fatalf("bob's queue = %s", got)
+	}
+
+	fake.setState(alicePrompt, "completed")
+	fake.setState(bobPrompt, "completed")
+	var history map[string]comfyHistoryEntry
+	getJSON(t, mux, as(httptest.NewRequest(http.MethodGet, "/history", nil), "bob"), &history)
+	if _, ok := history[bobPrompt]; !ok || len(history) != 1 {
+		t.Fatalf("bob's history = %v", history)
+	}
+	history = nil
+	getJSON(t, mux, as(httptest.NewRequest(http.MethodGet, "/history/"+alicePrompt, nil), "bob"), &history)
+	if len(history) != 0 {
+		t.Fatalf("bob read alice's prompt: %v", history)
+	}
+	getJSON(t, mux, as(httptest.NewRequest(http.MethodGet, "/history/"+alicePrompt, nil), "alice"), &history)
+	if _, ok := history[alicePrompt]; !ok {
+		t.Fatalf("alice's history misses her prompt: %v", history)
+	}
+}
+
+func TestComfyRoutesServedAtRootAndAPI(t *testing.T) {
+	fake := &fakeOrchestrator{}
+	fake.add("completed", "alice")
+	mux := http.NewServeMux()
+	newComfyCompat(newTestGateway(fake)).register(mux)
+
+	for _, prefix := range []string{"", "/api"} {
+		for _, path := range []string{"/prompt", "/queue", "/history", "/history/job-1", "/object_info", "/object_info/KSampler"} {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, as(httptest.NewRequest(http.MethodGet, prefix+path, nil), "alice"))
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET %s%s: status %d", prefix, path, rec.Code)
+			}
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, prefix+"/queue", nil))
+		if rec.Code != http.StatusNotImplemented {
+			t.Errorf("POST %s/queue: status %d, want 501", prefix, rec.Code)
+		}
+	}
+
+	var info map[string]comfyNodeInfo
+	getJSON(t, mux, httptest.NewRequest(http.MethodGet, "/api/object_info/KSampler", nil), &info)
+	if len(info) != 1 || info["KSampler"].Input.Required["steps"] == nil {
+		t.Fatalf("object_info/KSampler = %+v", info)
+	}
+}
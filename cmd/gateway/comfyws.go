@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"comfy-service-tests/internal/logging"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+
+	"golang.org/x/net/websocket"
+)
+
+// comfySocket is one ComfyUI /ws connection. Events for prompts submitted
+// with its clientId are written to it as {"type", "data"} JSON messages.
+type comfySocket struct {
+	conn     *websocket.Conn
+	clientID string
+	jobs     chan string
+
+	writeMu sync.Mutex
+}
+
+type comfyMessage struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+func (s *comfySocket) send(kind string, data any) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return websocket.JSON.Send(s.conn, comfyMessage{Type: kind, Data: data})
+}
+
+// checkWSHandshake admits /ws connections whose clientId is well formed and
+// not bound to another caller's session, after the usual origin check.
+func (c *comfyCompat) checkWSHandshake(config *websocket.Config, r *http.Request) error {
+	if err := c.g.cors.checkWebSocketOrigin(config, r); err != nil {
+		return err
+	}
+	clientID := r.URL.Query().Get("clientId")
+	if clientID == "" {
+		return nil
+	}
+	if !validClientID(clientID) {
+		return errors.New("invalid clientId")
+	}
+	return c.g.sessions.check(clientID, sessionPrincipal(r))
+}
+
+func (c *comfyCompat) serveWS(conn *websocket.Conn) {
+	clientID := conn.Request().URL.Query().Get("clientId")
+	if clientID == "" {
+		clientID = newClientID()
+	}
+	socket := &comfySocket{conn: conn, clientID: clientID, jobs: make(chan string, 16)}
+	c.mu.Lock()
+	c.sockets[socket] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.sockets, socket)
+		c.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		// Clients only send keepalives; a read error means the socket closed.
+		defer cancel()
+		var discard string
+		for websocket.Message.Receive(conn, &discard) == nil {
+		}
+	}()
+
+	slog.InfoContext(ctx, "comfy websocket connected", "client_id", clientID)
+	if err := socket.send("status", c.statusData(ctx, clientID)); err != nil {
+		return
+	}
+
+	var watchers sync.WaitGroup
+	defer watchers.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.g.shutdown.Done():
+			return
+		case id := <-socket.jobs:
+			watchers.Add(1)
+			go func() {
+				defer watchers.Done()
+				c.watchPrompt(ctx, socket, id)
+			}()
+		}
+	}
+}
+
+// notifySockets hands a new prompt to the sockets of the client that
+// submitted it. Prompts posted without a client id are not streamed.
+func (c *comfyCompat) notifySockets(clientID, id string) {
+	if clientID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for socket := range c.sockets {
+		if socket.clientID != clientID {
+			continue
+		}
+		select {
+		case socket.jobs <- id:
+		default:
+			slog.Warn("comfy websocket backlog full, dropping prompt events", "client_id", socket.clientID, "job_id", id)
+		}
+	}
+}
+
+func (c *comfyCompat) statusData(ctx context.Context, clientID string) map[string]any {
+	remaining, err := c.queueRemaining(ctx)
+	if err != nil {
+		slog.DebugContext(ctx, "queue status failed", "err", err)
+	}
+	return map[string]any{
+		"status": map[string]any{"exec_info": map[string]int{"queue_remaining": remaining}},
+		"sid":    clientID,
+	}
+}
+
+// watchPrompt translates the orchestrator's status stream for one job into
+// ComfyUI's execution_start, executing, progress, executed and
+// execution_success/execution_error messages.
+func (c *comfyCompat) watchPrompt(ctx context.Context, socket *comfySocket, id string) {
+	ctx = logging.WithJob(ctx, id)
+	stream, err := c.g.client.StreamStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: id})
+	if err != nil {
+		slog.WarnContext(ctx, "comfy websocket stream failed", "err", err)
+		return
+	}
+
+	started := false
+	lastProgress := -1
+	running := ""
+	nodeStates := map[int64]string{}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			slog.DebugContext(ctx, "comfy websocket stream ended", "err", err)
+			return
+		}
+		if !started && event.State != "queued" {
+			started = true
+			if socket.send("execution_start", map[string]any{"prompt_id": id, "timestamp": time.Now().UnixMilli()}) != nil {
+				return
+			}
+		}
+		for _, node := range event.Nodes {
+			if node.State == "running" && nodeStates[node.NodeId] != "running" {
+				running = strconv.FormatInt(node.NodeId, 10)
+				if socket.send("executing", map[string]any{"node": running, "display_node": running, "prompt_id": id}) != nil {
+					return
+				}
+			}
+			nodeStates[node.NodeId] = node.State
+		}
+		if progress := int(event.Progress * 100); event.State == "running" && progress != lastProgress {
+			lastProgress = progress
+			if socket.send("progress", map[string]any{"value": progress, "max": 100, "prompt_id": id, "node": running}) != nil {
+				return
+			}
+		}
+
+		switch event.State {
+		case "completed":
+			c.sendExecuted(ctx, socket, id)
+			_ = socket.send("executing", map[string]any{"node": nil, "prompt_id": id})
+			_ = socket.send("execution_success", map[string]any{"prompt_id": id, "timestamp": time.Now().UnixMilli()})
+			_ = socket.send("status", c.statusData(ctx, socket.clientID))
+			return
+		case "failed":
+			_ = socket.send("execution_error", map[string]any{
+				"prompt_id":         id,
+				"node_id":           running,
+				"exception_message": event.Message,
+				"exception_type":    "StageError",
+				"traceback":         []string{},
+				"timestamp":         time.Now().UnixMilli(),
+			})
+			_ = socket.send("status", c.statusData(ctx, socket.clientID))
+			return
+		}
+	}
+}
+
+func (c *comfyCompat) sendExecuted(ctx context.Context, socket *comfySocket, id string) {
+	statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := c.g.client.GetWorkflowStatus(statusCtx, &orchestratorv1.StatusRequest{WorkflowId: id})
+	if err != nil {
+		slog.WarnContext(ctx, "comfy output lookup failed", "err", err)
+		return
+	}
+	image, ok := c.imageFor(id, resp.Output)
+	if !ok {
+		return
+	}
+	node := c.outputNode(id)
+	_ = socket.send("executed", map[string]any{
+		"node":         node,
+		"display_node": node,
+		"output":       map[string][]comfyImage{"images": {image}},
+		"prompt_id":    id,
+	})
+}
+
+func newClientID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComfyNotifySocketsOnlyReachesSubmitter(t *testing.T) {
+	c := newComfyCompat(newTestGateway(&fakeOrchestrator{}))
+	mine := &comfySocket{clientID: "client-a", jobs: make(chan string, 1)}
+	other := &comfySocket{clientID: "client-b", jobs: make(chan string, 1)}
+	c.sockets[mine] = struct{}{}
+	c.sockets[other] = struct{}{}
+
+	c.notifySockets("", "job-1")
+	c.notifySockets("client-a", "job-2")
+
+	if got := <-mine.jobs; got != "job-2" {
+		t.Fatalf("submitter socket got %q, want job-2", got)
+	}
+	select {
+	case id := <-other.jobs:
+		t.Fatalf("other client's socket got %q", id)
+	default:
+	}
+}
+
+func TestComfyWSHandshakeChecksClientID(t *testing.T) {
+	g := newTestGateway(&fakeOrchestrator{})
+	c := newComfyCompat(g)
+	if err := g.sessions.record("client-a", "alice", "job-1"); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		subject  string
+		accepted bool
+	}{
+		{"no client id", "", "bob", true},
+		{"own session", "?clientId=client-a", "alice", true},
+		{"another caller's session", "?clientId=client-a", "bob", false},
+		{"invalid characters", "?clientId=a%3Cb%3E", "alice", false},
+		{"too long", "?clientId=" + strings.Repeat("a", maxClientIDLength+1), "alice", false},
+	} {
+		r := as(httptest.NewRequest(http.MethodGet, "/ws"+tc.query, nil), tc.subject)
+		err := c.checkWSHandshake(nil, r)
+		if (err == nil) != tc.accepted {
+			t.Errorf("%s: handshake error = %v, want accepted=%v", tc.name, err, tc.accepted)
+		}
+	}
+}
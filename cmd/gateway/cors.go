@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	defaultCORSMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	defaultCORSHeaders = "Content-Type, Authorization, X-API-Key"
+	defaultCORSMaxAge  = 10 * time.Minute
+)
+
+// corsPolicy decides which browser origins may call the gateway.
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	suffixes    []string // "https://*.example.com" is stored as "https://.example.com"
+	methods     []string
+	headers     []string
+	exposed     []string
+	credentials bool
+	maxAge      time.Duration
+}
+
+// loadCORSPolicy reads the policy from the environment:
+//
+//	CORS_ALLOWED_ORIGINS    comma list of origins, "*", or "https://*.example.com" (default "*")
+//	CORS_ALLOWED_METHODS    default "GET, POST, PUT, DELETE, OPTIONS"
+//	CORS_ALLOWED_HEADERS    default "Content-Type, Authorization, X-API-Key"
+//	CORS_EXPOSED_HEADERS    response headers scripts may read (default none)
+//	CORS_ALLOW_CREDENTIALS  "true" to allow cookies and auth headers
+//	CORS_MAX_AGE            preflight cache lifetime (default 10m)
+func loadCORSPolicy() (*corsPolicy, error) {
+	credentials := false
+	if raw := os.Getenv("CORS_ALLOW_CREDENTIALS"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("CORS_ALLOW_CREDENTIALS: %w", err)
+		}
+		credentials = parsed
+	}
+	maxAge := defaultCORSMaxAge
+	if raw := os.Getenv("CORS_MAX_AGE"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("CORS_MAX_AGE: invalid duration %q", raw)
+		}
+		maxAge = parsed
+	}
+	return newCORSPolicy(
+		parseTokenList(envOrDefault("CORS_ALLOWED_ORIGINS", "*")),
+		splitHeaderList(envOrDefault("CORS_ALLOWED_METHODS", defaultCORSMethods)),
+		splitHeaderList(envOrDefault("CORS_ALLOWED_HEADERS", defaultCORSHeaders)),
+		splitHeaderList(os.Getenv("CORS_EXPOSED_HEADERS")),
+		credentials,
+		maxAge,
+	)
+}
+
+func newCORSPolicy(origins, methods, headers, exposed []string, credentials bool, maxAge time.Duration) (*corsPolicy, error) {
+	policy := &corsPolicy{
+		origins:     make(map[string]bool),
+		credentials: credentials,
+		maxAge:      maxAge,
+		exposed:     exposed,
+	}
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(origin, "/")
+		switch {
+		case origin == "*":
+			policy.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			policy.suffixes = append(policy.suffixes, strings.Replace(origin, "://*.", "://.", 1))
+		case strings.Contains(origin, "://"):
+			policy.origins[origin] = true
+		default:
+			return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS: %q is not an origin (scheme://host[:port])", origin)
+		}
+	}
+	if policy.anyOrigin && credentials {
+		return nil, fmt.Errorf("CORS_ALLOW_CREDENTIALS needs explicit CORS_ALLOWED_ORIGINS, not *")
+	}
+	for _, method := range methods {
+		policy.methods = append(policy.methods, strings.ToUpper(method))
+	}
+	for _, header := range headers {
+		policy.headers = append(policy.headers, http.CanonicalHeaderKey(header))
+	}
+	return policy, nil
+}
+
+func splitHeaderList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// allowOrigin reports whether origin may call the gateway.
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.suffixes {
+		scheme, suffix, _ := strings.Cut(pattern, "://")
+		host, ok := strings.CutPrefix(origin, scheme+"://")
+		if ok && strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	for _, allowed := range p.methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	for _, header := range splitHeaderList(requested) {
+		header = http.CanonicalHeaderKey(header)
+		found := false
+		for _, allowed := range p.headers {
+			if allowed == header {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// allowedOrigin is the Access-Control-Allow-Origin value for origin.
+func (p *corsPolicy) allowedOrigin(origin string) string {
+	if p.anyOrigin {
+		return "*"
+	}
+	return origin
+}
+
+// checkWebSocketOrigin is a websocket.Server handshake. Browsers do not apply
+// CORS to WebSockets, so cross-site handshakes are checked against the same
+// origin list; clients that send no Origin (non-browsers) are admitted.
+func (p *corsPolicy) checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.allowOrigin(origin) {
+		return nil
+	}
+	return fmt.Errorf("websocket origin %q not allowed", origin)
+}
+
+// handler applies the policy. Requests from disallowed origins are served
+// without CORS headers, so browsers block the response; disallowed
+// preflights are rejected with 403.
+func (p *corsPolicy) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		// Responses differ by origin unless every origin gets "*".
+		if !p.anyOrigin {
+			header.Add("Vary", "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			method := r.Header.Get("Access-Control-Request-Method")
+			requested := r.Header.Get("Access-Control-Request-Headers")
+			if origin == "" || !p.allowOrigin(origin) || !p.allowMethod(method) || !p.allowHeaders(requested) {
+				slog.DebugContext(r.Context(), "cors preflight rejected", "origin", origin, "method", method, "headers", requested)
+				http.Error(w, "cors preflight rejected", http.StatusForbidden)
+				return
+			}
+			header.Set("Access-Control-Allow-Origin", p.allowedOrigin(origin))
+			header.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+			if len(p.headers) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+			}
+			if p.credentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if p.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if origin != "" && p.allowOrigin(origin) {
+			header.Set("Access-Control-Allow-Origin", p.allowedOrigin(origin))
+			if p.credentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if len(p.exposed) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(p.exposed, ", "))
+			}
+		}
+		if r.Method == http.MethodOptions {
+			header.Set("Allow", strings.Join(p.methods, ", "))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	policy, err := newCORSPolicy(
+		[]string{"https://app.example.com", "https://*.example.org"},
+		splitHeaderList(defaultCORSMethods),
+		splitHeaderList(defaultCORSHeaders),
+		nil, true, defaultCORSMaxAge,
+	)
+	if err != nil {
+		t.Fatalf("newCORSPolicy: %v", err)
+	}
+	reached := false
+	handler := policy.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+
+	for _, tc := range []struct {
+		origin, method, headers string
+		allowed                 bool
+	}{
+		{"https://app.example.com", "POST", "Content-Type", true},
+		{"https://ui.example.org", "GET", "X-API-Key", true},
+		{"https://evil.example.net", "POST", "Content-Type", false},
+		{"https://example.org", "GET", "", false},
+		{"https://app.example.com", "PATCH", "", false},
+		{"https://app.example.com", "POST", "X-Other", false},
+	} {
+		reached = false
+		r := httptest.NewRequest(http.MethodOptions, "/v1/workflows", nil)
+		r.Header.Set("Origin", tc.origin)
+		r.Header.Set("Access-Control-Request-Method", tc.method)
+		r.Header.Set("Access-Control-Request-Headers", tc.headers)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		allowOrigin := rec.Header().Get("Access-Control-Allow-Origin")
+		if tc.allowed {
+			if rec.Code != http.StatusNoContent || allowOrigin != tc.origin || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Errorf("%s %s: status %d, allow-origin %q", tc.origin, tc.method, rec.Code, allowOrigin)
+			}
+		} else if rec.Code != http.StatusForbidden || allowOrigin != "" {
+			t.Errorf("%s %s %q: status %d, allow-origin %q, want 403 without CORS headers", tc.origin, tc.method, tc.headers, rec.Code, allowOrigin)
+		}
+		if reached {
+			t.Errorf("%s: preflight reached the handler", tc.origin)
+		}
+	}
+}
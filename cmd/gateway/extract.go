@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"comfy-service-tests/internal/imaging"
+)
+
+// maxExtractUpload bounds image uploads to /v1/workflows/extract.
+const maxExtractUpload = 32 << 20
+
+type extractResponse struct {
+	Format   string          `json:"format"`
+	Workflow json.RawMessage `json:"workflow,omitempty"`
+	Prompt   json.RawMessage `json:"prompt,omitempty"`
+}
+
+// handleWorkflowExtract returns the ComfyUI graph embedded in an uploaded
+// image. It accepts a multipart form (field "image", else any file field) or
+// a raw image body.
+func (g *gateway) handleWorkflowExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxExtractUpload)
+	payload, err := readUploadedImage(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "image too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found, err := imaging.ExtractWorkflow(payload)
+	switch {
+	case errors.Is(err, imaging.ErrNoWorkflow):
+		http.Error(w, "image has no embedded workflow", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		slog.WarnContext(r.Context(), "workflow extraction failed", "bytes", len(payload), "err", err)
+		http.Error(w, "unsupported image", http.StatusUnsupportedMediaType)
+		return
+	}
+	slog.InfoContext(r.Context(), "workflow extracted", "container", found.Container, "bytes", len(payload))
+	writeJSON(w, http.StatusOK, extractResponse{Format: found.Container, Workflow: found.Workflow, Prompt: found.Prompt})
+}
+
+func readUploadedImage(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		payload, err := io.ReadAll(r.Body)
+		if err == nil && len(payload) == 0 {
+			err = errors.New("missing image")
+		}
+		return payload, err
+	}
+
+	if err := r.ParseMultipartForm(maxExtractUpload); err != nil {
+		return nil, err
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		for _, candidates := range r.MultipartForm.File {
+			files = candidates
+			break
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("missing image")
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
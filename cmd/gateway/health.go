@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// readyCheckTimeout bounds the orchestrator probe behind /readyz.
+	readyCheckTimeout = 2 * time.Second
+	// unavailableRetryAfter is suggested when the orchestrator cannot take work.
+	unavailableRetryAfter = 5 * time.Second
+)
+
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// handleHealthz is the liveness probe: the process is up and serving HTTP.
+func (g *gateway) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe. It fails while the gateway is shutting
+// down and whenever the orchestrator does not report SERVING, which it does
+// only while its stage backend passes health checks.
+func (g *gateway) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := readyResponse{Status: "ready", Checks: map[string]string{}}
+	if g.shutdown.Err() != nil {
+		resp.Status = "not_ready"
+		resp.Checks["gateway"] = "shutting down"
+	} else {
+		resp.Checks["gateway"] = "ok"
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+	check, err := g.health.Check(ctx, &healthpb.HealthCheckRequest{Service: orchestratorv1.Orchestrator_ServiceDesc.ServiceName})
+	switch {
+	case err != nil:
+		resp.Status = "not_ready"
+		resp.Checks["orchestrator"] = err.Error()
+		slog.WarnContext(r.Context(), "readiness check failed", "err", err)
+	case check.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+		resp.Status = "not_ready"
+		resp.Checks["orchestrator"] = check.GetStatus().String()
+	default:
+		resp.Checks["orchestrator"] = check.GetStatus().String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// backendUnavailable reports whether a submission failed because the
+// orchestrator is unreachable, draining, or has no healthy stage backend.
+// Callers answer 503 with Retry-After rather than 502.
+func backendUnavailable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
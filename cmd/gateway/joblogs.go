@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/logging"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+)
+
+const jobLogPollInterval = 500 * time.Millisecond
+
+// handleJobLogs returns the job's captured log lines. With ?follow=1 the
+// response stays open and streams new lines until the job finishes. With a
+// remote store, services upload their lines when they finish with the job;
+// those follow the shared job.log.
+func (g *gateway) handleJobLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := jobIDFromPath(w, r, "/logs")
+	if !ok {
+		return
+	}
+	key, err := logging.JobLogKey(id)
+	if err != nil {
+		slog.WarnContext(r.Context(), "job log key rejected", "job_id", id, "err", err)
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	ctx := logging.WithJob(r.Context(), id)
+
+	follow := isTruthy(r.URL.Query().Get("follow"))
+	body, _, err := g.store.Get(ctx, key)
+	if err != nil && !errors.Is(err, artifacts.ErrNotFound) {
+		slog.WarnContext(ctx, "job log read failed", "key", key, "err", err)
+		http.Error(w, "job log not found", http.StatusNotFound)
+		return
+	}
+	if body != nil {
+		defer body.Close()
+	}
+
+	if !follow {
+		serviceLogs := g.serviceJobLogs(ctx, id)
+		if body == nil && len(serviceLogs) == 0 {
+			http.Error(w, "job log not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if body != nil {
+			if _, err := io.Copy(w, body); err != nil {
+				slog.DebugContext(ctx, "job log copy ended", "err", err)
+				return
+			}
+		}
+		g.copyServiceJobLogs(ctx, w, serviceLogs)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	keepOpen(w)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(jobLogPollInterval)
+	defer ticker.Stop()
+	for {
+		if body == nil {
+			body, _, _ = g.store.Get(ctx, key)
+			if body != nil {
+				defer body.Close()
+			}
+		}
+		if body != nil {
+			if _, err := io.Copy(w, body); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+
+		done := g.jobFinished(ctx, id)
+		if done {
+			if body != nil {
+				_, _ = io.Copy(w, body)
+			}
+			g.copyServiceJobLogs(ctx, w, g.serviceJobLogs(ctx, id))
+			flusher.Flush()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.shutdown.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serviceJobLogs lists the per-service copies of a job's log that services
+// upload to remote stores, in key order.
+func (g *gateway) serviceJobLogs(ctx context.Context, id string) []string {
+	objects, err := g.store.List(ctx, id+"/job.")
+	if err != nil {
+		slog.WarnContext(ctx, "list job logs failed", "err", err)
+		return nil
+	}
+	var keys []string
+	for _, object := range objects {
+		if name := path.Base(object.Key); name != logging.JobLogName && strings.HasSuffix(name, ".log") && path.Dir(object.Key) == id {
+			keys = append(keys, object.Key)
+		}
+	}
+	return keys
+}
+
+func (g *gateway) copyServiceJobLogs(ctx context.Context, w io.Writer, keys []string) {
+	for _, key := range keys {
+		body, _, err := g.store.Get(ctx, key)
+		if err != nil {
+			slog.WarnContext(ctx, "job log read failed", "key", key, "err", err)
+			continue
+		}
+		_, err = io.Copy(w, body)
+		body.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (g *gateway) jobFinished(ctx context.Context, id string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := g.client.GetWorkflowStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: id})
+	if err != nil {
+		return false
+	}
+	switch resp.State {
+	case "completed", "failed", "unknown":
+		return true
+	}
+	return false
+}
+
+func isTruthy(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"comfy-service-tests/internal/artifacts"
+)
+
+// remoteStore hides the file store's type, standing in for S3.
+type remoteStore struct {
+	artifacts.Store
+}
+
+func TestJobLogsServedFromRemoteStore(t *testing.T) {
+	files, err := artifacts.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for key, line := range map[string]string{
+		"job-1/job.orchestrator.log":  "msg=\"job dispatched\" service=orchestrator\n",
+		"job-1/job.stage-sampler.log": "msg=\"stage started\" service=stage-sampler\n",
+		"job-1/output.png":            "png",
+		"job-10/job.orchestrator.log": "msg=\"another job\"\n",
+	} {
+		if _, err := artifacts.PutBytes(ctx, files, key, []byte(line), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := newTestGateway(&fakeOrchestrator{})
+	g.store = remoteStore{files}
+
+	rec := httptest.NewRecorder()
+	g.handleJobLogs(rec, httptest.NewRequest(http.MethodGet, "/v1/jobs/job-1/logs", nil))
+	want := "msg=\"job dispatched\" service=orchestrator\nmsg=\"stage started\" service=stage-sampler\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	g.handleJobLogs(rec, httptest.NewRequest(http.MethodGet, "/v1/jobs/job-2/logs", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing job log: status %d, want 404", rec.Code)
+	}
+}
@@ -3,34 +3,49 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/auth"
+	"comfy-service-tests/internal/grpctls"
+	"comfy-service-tests/internal/jobid"
 	"comfy-service-tests/internal/logging"
+	"comfy-service-tests/internal/metrics"
+	"comfy-service-tests/internal/orchestrator"
 
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"comfy-service-tests/internal/tracing"
 
+	"golang.org/x/net/websocket"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/backoff"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type jobResponse struct {
-	JobID  string `json:"job_id"`
-	Status string `json:"status"`
+	JobID    string `json:"job_id"`
+	Status   string `json:"status"`
+	ClientID string `json:"client_id,omitempty"`
 }
 
 type statusResponse struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	Detail string `json:"detail,omitempty"`
+	ID     string                    `json:"id"`
+	Status string                    `json:"status"`
+	Detail string                    `json:"detail,omitempty"`
+	Timing *orchestratorv1.JobTiming `json:"timing,omitempty"`
 }
 
 type checkpointsResponse struct {
@@ -60,13 +75,20 @@ var checkpointBlacklist = append([]string{}, defaultCheckpointBlacklist...)
 var checkpointAllowlist []string
 
 type gateway struct {
-	mu                 sync.Mutex
 	client             orchestratorv1.OrchestratorClient
-	lastJobID          string
-	artifactsRoot      string
+	health             healthpb.HealthClient
+	auth               *auth.Authenticator
+	cors               *corsPolicy
+	limits             submissionLimits
+	sessions           *sessionStore
+	store              artifacts.Store
+	signedURLTTL       time.Duration
 	checkpointsDir     string
 	minCheckpointBytes int64
 	maxCheckpointBytes int64
+	// shutdown ends when the listener starts shutting down; streaming
+	// handlers send a final message and return.
+	shutdown context.Context
 }
 
 func main() {
@@ -79,37 +101,117 @@ func main() {
 	checkpointAllowlist = append(checkpointAllowlist, parseTokenList(os.Getenv("CHECKPOINT_ALLOWLIST"))...)
 	checkpointBlacklist = append(checkpointBlacklist, parseTokenList(os.Getenv("CHECKPOINT_BLACKLIST"))...)
 	logDir := envOrDefault("LOG_DIR", "/logs")
+	signedURLTTL := envDurationOrDefault("ARTIFACT_SIGNED_URL_TTL", 0)
 
 	if _, err := logging.Setup("gateway", logDir); err != nil {
 		log.Fatalf("failed to set up logging: %v", err)
 	}
-	log.Printf("starting gateway addr=%s orchestrator=%s artifacts=%s", addr, orchestratorAddr, artifactsRoot)
+	tracer, err := tracing.Setup("gateway", logDir)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	slog.Info("starting gateway", "addr", addr, "orchestrator", orchestratorAddr, "artifacts", artifactsRoot)
+
+	authenticator, err := loadAuthenticator()
+	if err != nil {
+		log.Fatalf("failed to load gateway credentials: %v", err)
+	}
+	if !authenticator.Enabled() {
+		slog.Warn("authentication disabled; set GATEWAY_API_KEYS_FILE or GATEWAY_TOKEN_SECRET to require credentials")
+	}
+
+	cors, err := loadCORSPolicy()
+	if err != nil {
+		log.Fatalf("invalid CORS configuration: %v", err)
+	}
+
+	listener, err := loadListenerConfig()
+	if err != nil {
+		log.Fatalf("invalid gateway listener configuration: %v", err)
+	}
+
+	store, err := artifacts.OpenFromEnv(artifactsRoot)
+	if err != nil {
+		log.Fatalf("failed to open artifact store: %v", err)
+	}
 
-	conn, err := grpc.Dial(orchestratorAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	tlsConfig, err := grpctls.FromEnv()
+	if err != nil {
+		log.Fatalf("invalid gRPC TLS configuration: %v", err)
+	}
+	creds, err := tlsConfig.DialOption()
+	if err != nil {
+		log.Fatalf("failed to load gRPC TLS credentials: %v", err)
+	}
+
+	// A capped reconnect backoff lets /readyz recover soon after an
+	// orchestrator restart.
+	conn, err := grpc.Dial(
+		orchestratorAddr,
+		creds,
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: time.Second, Multiplier: 1.6, Jitter: 0.2, MaxDelay: 5 * time.Second},
+			MinConnectTimeout: 5 * time.Second,
+		}),
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor(), metrics.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor(), metrics.StreamClientInterceptor()),
+	)
 	if err != nil {
 		log.Fatalf("failed to dial orchestrator at %s: %v", orchestratorAddr, err)
 	}
 
+	shutdown, beginShutdown := context.WithCancel(context.Background())
 	g := &gateway{
 		client:             orchestratorv1.NewOrchestratorClient(conn),
-		artifactsRoot:      artifactsRoot,
+		health:             healthpb.NewHealthClient(conn),
+		auth:               authenticator,
+		cors:               cors,
+		limits:             loadSubmissionLimits(),
+		sessions:           newSessionStore(),
+		store:              store,
+		signedURLTTL:       signedURLTTL,
 		checkpointsDir:     checkpointsDir,
 		minCheckpointBytes: minCheckpointBytes,
 		maxCheckpointBytes: maxCheckpointBytes,
+		shutdown:           shutdown,
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/nodes", g.handleNodes)
 	mux.HandleFunc("/v1/checkpoints", g.handleCheckpoints)
 	mux.HandleFunc("/v1/workflows", g.handleWorkflows)
+	mux.HandleFunc("/v1/workflows/extract", g.handleWorkflowExtract)
 	mux.HandleFunc("/v1/jobs/", g.handleJob)
 	mux.HandleFunc("/v1/jobs", g.handleJobIndex)
 	mux.HandleFunc("/v1/events", g.handleEvents)
+	mux.HandleFunc("/v1/session", g.handleSession)
+	mux.HandleFunc("/v1/auth/token", g.handleToken)
+	mux.Handle("/v1/ws", longLived(websocket.Server{Handler: g.serveEventSocket, Handshake: cors.checkWebSocketOrigin}))
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", g.handleHealthz)
+	mux.HandleFunc("/readyz", g.handleReadyz)
+	newComfyCompat(g).register(mux)
+
+	srv, err := listener.newServer(addr, tracing.Middleware(logRequests(metrics.InstrumentHandler(routeLabel, cors.handler(auth.Middleware(authenticator, requiredScope, mux))))))
+	if err != nil {
+		log.Fatalf("failed to configure gateway listener: %v", err)
+	}
+	srv.RegisterOnShutdown(beginShutdown)
 
-	log.Printf("gateway listening on %s", addr)
-	if err := http.ListenAndServe(addr, logRequests(withCORS(mux))); err != nil {
-		log.Fatalf("gateway stopped: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("gateway listening", "addr", addr, "mode", listener.mode())
+	runErr := listener.run(ctx, srv, envDurationOrDefault("GATEWAY_SHUTDOWN_TIMEOUT", 30*time.Second))
+	_ = conn.Close()
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := tracer.Shutdown(flushCtx); err != nil {
+		slog.Warn("tracing shutdown failed", "err", err)
+	}
+	if runErr != nil {
+		log.Fatalf("gateway stopped: %v", runErr)
 	}
+	slog.Info("gateway stopped")
 }
 
 func (g *gateway) handleNodes(w http.ResponseWriter, r *http.Request) {
@@ -122,7 +224,7 @@ func (g *gateway) handleNodes(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := g.client.ListNodes(ctx, &orchestratorv1.ListNodesRequest{})
 	if err != nil {
-		log.Printf("list nodes failed: %v", err)
+		slog.ErrorContext(ctx, "list nodes failed", "err", err)
 		http.Error(w, "failed to load node catalog", http.StatusBadGateway)
 		return
 	}
@@ -131,6 +233,10 @@ func (g *gateway) handleNodes(w http.ResponseWriter, r *http.Request) {
 }
 
 func (g *gateway) handleWorkflows(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		g.listWorkflows(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -146,27 +252,58 @@ func (g *gateway) handleWorkflows(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
 		return
 	}
+	if ok, wait := g.admitSubmission(r); !ok {
+		setRetryAfter(w, wait)
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	// Accept both the UI save format and the API ("prompt") format.
+	format, err := orchestrator.DetectWorkflowFormat(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID := ensureClientID(w, r)
+	principal := sessionPrincipal(r)
+	if err := g.sessions.check(sessionID, principal); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
 	execResp, err := g.client.ExecuteWorkflow(ctx, &orchestratorv1.ExecuteWorkflowRequest{
 		Graph: &orchestratorv1.WorkflowGraph{
-			Format:       "comfyui",
+			Format:       format,
 			WorkflowJson: string(payload),
 		},
+		Metadata: g.withQuota(r, withSubmitter(r, map[string]string{"client_id": sessionID})),
 	})
+	if message, ok := quotaExceeded(err); ok {
+		setRetryAfter(w, quotaRetryAfter)
+		http.Error(w, message, http.StatusTooManyRequests)
+		return
+	}
+	if backendUnavailable(err) {
+		slog.WarnContext(ctx, "submit workflow refused", "err", err)
+		setRetryAfter(w, unavailableRetryAfter)
+		http.Error(w, "workflow backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		log.Printf("submit workflow failed: %v", err)
+		slog.ErrorContext(ctx, "submit workflow failed", "err", err)
 		http.Error(w, "failed to submit workflow", http.StatusBadGateway)
 		return
 	}
 
-	g.mu.Lock()
-	g.lastJobID = execResp.WorkflowId
-	g.mu.Unlock()
+	if err := g.sessions.record(sessionID, principal, execResp.WorkflowId); err != nil {
+		slog.WarnContext(ctx, "job not recorded in session", "client_id", sessionID, "err", err)
+	}
+	slog.InfoContext(logging.WithJob(ctx, execResp.WorkflowId), "workflow submitted", "format", format, "bytes", len(payload), "client_id", sessionID)
 
-	writeJSON(w, http.StatusAccepted, jobResponse{JobID: execResp.WorkflowId, Status: "queued"})
+	writeJSON(w, http.StatusAccepted, jobResponse{JobID: execResp.WorkflowId, Status: "queued", ClientID: sessionID})
 }
 
 func (g *gateway) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
@@ -177,7 +314,7 @@ func (g *gateway) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
 
 	checkpoints, err := listCheckpoints(g.checkpointsDir, g.minCheckpointBytes, g.maxCheckpointBytes)
 	if err != nil {
-		log.Printf("list checkpoints failed dir=%s err=%v", g.checkpointsDir, err)
+		slog.ErrorContext(r.Context(), "list checkpoints failed", "dir", g.checkpointsDir, "err", err)
 		http.Error(w, "failed to list checkpoints", http.StatusInternalServerError)
 		return
 	}
@@ -185,15 +322,55 @@ func (g *gateway) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, checkpointsResponse{Checkpoints: checkpoints})
 }
 
+type workflowListResponse struct {
+	Workflows  []*orchestratorv1.WorkflowSummary `json:"workflows"`
+	NextBefore string                            `json:"next_before,omitempty"`
+}
+
+// listWorkflows serves GET /v1/workflows?limit=&before=&state=, newest first.
+func (g *gateway) listWorkflows(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if query.Get("limit") != "" && (err != nil || limit < 0) {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	before := query.Get("before")
+	if before != "" && !jobid.Valid(before) {
+		http.Error(w, "invalid before cursor", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	resp, err := g.client.ListWorkflows(ctx, &orchestratorv1.ListWorkflowsRequest{
+		Limit:  int32(limit),
+		Before: before,
+		State:  query.Get("state"),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "list workflows failed", "err", err)
+		http.Error(w, "failed to list workflows", http.StatusBadGateway)
+		return
+	}
+	workflows := resp.Workflows
+	if workflows == nil {
+		workflows = []*orchestratorv1.WorkflowSummary{}
+	}
+	writeJSON(w, http.StatusOK, workflowListResponse{Workflows: workflows, NextBefore: resp.NextBefore})
+}
+
 func (g *gateway) handleJobIndex(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	g.mu.Lock()
-	jobID := g.lastJobID
-	g.mu.Unlock()
-
+	// Without an id, report the caller's current job rather than anyone's.
+	jobID, err := g.sessions.current(clientID(r), sessionPrincipal(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if jobID == "" {
 		writeJSON(w, http.StatusOK, statusResponse{ID: "", Status: "idle"})
 		return
@@ -207,33 +384,55 @@ func (g *gateway) handleJob(w http.ResponseWriter, r *http.Request) {
 		g.handleJobOutput(w, r)
 		return
 	}
+	if strings.HasSuffix(r.URL.Path, "/timeline") {
+		g.handleJobTimeline(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/logs") {
+		g.handleJobLogs(w, r)
+		return
+	}
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	id := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
-	if id == "" {
-		http.Error(w, "missing job id", http.StatusBadRequest)
+	id, ok := jobIDFromPath(w, r, "")
+	if !ok {
 		return
 	}
 
 	g.fetchStatus(w, r, id)
 }
 
+// jobIDFromPath extracts the id from /v1/jobs/<id><suffix> and rejects
+// anything that is not a well-formed job id, since ids name artifact paths.
+func jobIDFromPath(w http.ResponseWriter, r *http.Request, suffix string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/jobs/"), suffix)
+	if id == "" {
+		http.Error(w, "missing job id", http.StatusBadRequest)
+		return "", false
+	}
+	if err := jobid.Validate(id); err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
 func (g *gateway) fetchStatus(w http.ResponseWriter, r *http.Request, id string) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(logging.WithJob(r.Context(), id), 5*time.Second)
 	defer cancel()
 
 	resp, err := g.client.GetWorkflowStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: id})
 	if err != nil {
-		log.Printf("get status failed id=%s err=%v", id, err)
+		slog.ErrorContext(ctx, "get status failed", "err", err)
 		http.Error(w, "failed to get status", http.StatusBadGateway)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, statusResponse{ID: resp.WorkflowId, Status: resp.State, Detail: resp.Message})
+	writeJSON(w, http.StatusOK, statusResponse{ID: resp.WorkflowId, Status: resp.State, Detail: resp.Message, Timing: resp.Timing})
 }
 
 func (g *gateway) handleJobOutput(w http.ResponseWriter, r *http.Request) {
@@ -242,20 +441,94 @@ func (g *gateway) handleJobOutput(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/jobs/"), "/output")
-	if id == "" {
-		http.Error(w, "missing job id", http.StatusBadRequest)
+	id, ok := jobIDFromPath(w, r, "/output")
+	if !ok {
 		return
 	}
 
-	outputPath := filepath.Join(g.artifactsRoot, id, "output.png")
-	if _, err := os.Stat(outputPath); err != nil {
-		log.Printf("output missing id=%s path=%s err=%v", id, outputPath, err)
-		http.Error(w, "output not found", http.StatusNotFound)
+	ctx := logging.WithJob(r.Context(), id)
+	outputKey, contentType := g.outputLocation(ctx, id)
+	g.serveArtifact(ctx, w, r, outputKey, contentType)
+}
+
+// serveArtifact streams key from the store, or redirects to a signed URL when
+// enabled. An empty contentType uses the type recorded by the store.
+func (g *gateway) serveArtifact(ctx context.Context, w http.ResponseWriter, r *http.Request, outputKey, contentType string) {
+	ctx, span := tracing.Start(ctx, "artifact.read")
+	defer span.End()
+	span.SetAttribute("artifact.uri", g.store.URI(outputKey))
+
+	if g.signedURLTTL > 0 {
+		if _, err := g.store.Stat(ctx, outputKey); err == nil {
+			if signed, err := g.store.SignedURL(ctx, outputKey, g.signedURLTTL); err == nil {
+				http.Redirect(w, r, signed, http.StatusTemporaryRedirect)
+				return
+			}
+		}
+	}
+
+	body, obj, err := g.store.Get(ctx, outputKey)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, artifacts.ErrNotFound) || errors.Is(err, artifacts.ErrInvalidKey) {
+			slog.WarnContext(ctx, "output missing", "key", outputKey, "err", err)
+			http.Error(w, "output not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(ctx, "output read failed", "key", outputKey, "err", err)
+		http.Error(w, "failed to read output", http.StatusBadGateway)
 		return
 	}
+	defer body.Close()
 
-	http.ServeFile(w, r, outputPath)
+	if contentType == "" {
+		contentType = obj.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	if obj.ETag != "" {
+		w.Header().Set("ETag", obj.ETag)
+	}
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(outputKey), obj.ModTime, seeker)
+		return
+	}
+	if obj.ETag != "" && r.Header.Get("If-None-Match") == obj.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if obj.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		slog.DebugContext(ctx, "output copy ended", "err", err)
+	}
+}
+
+// outputLocation returns the store key and content type of a job's output,
+// taken from the image ref the orchestrator recorded. Jobs the orchestrator no
+// longer knows about fall back to the legacy <id>/output.png key.
+func (g *gateway) outputLocation(ctx context.Context, id string) (string, string) {
+	legacyKey := id + "/output.png"
+	statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := g.client.GetWorkflowStatus(statusCtx, &orchestratorv1.StatusRequest{WorkflowId: id})
+	if err != nil || resp.GetOutput() == nil {
+		if err != nil {
+			slog.DebugContext(ctx, "output ref lookup failed, using legacy key", "err", err)
+		}
+		return legacyKey, ""
+	}
+	ref := resp.GetOutput()
+	_, key, err := artifacts.NewResolver(g.store).Resolve(ref.GetUri())
+	if err != nil || !strings.HasPrefix(key, id+"/") {
+		slog.WarnContext(ctx, "output ref not servable, using legacy key", "uri", ref.GetUri(), "err", err)
+		return legacyKey, ""
+	}
+	contentType := ""
+	if strings.HasPrefix(ref.GetDtype(), "image/") {
+		contentType = ref.GetDtype()
+	}
+	return key, contentType
 }
 
 func (g *gateway) handleEvents(w http.ResponseWriter, r *http.Request) {
@@ -266,26 +539,34 @@ func (g *gateway) handleEvents(w http.ResponseWriter, r *http.Request) {
 
 	jobID := r.URL.Query().Get("id")
 	if jobID == "" {
-		g.mu.Lock()
-		jobID = g.lastJobID
-		g.mu.Unlock()
+		current, err := g.sessions.current(clientID(r), sessionPrincipal(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		jobID = current
 	}
 
 	if jobID == "" {
 		http.Error(w, "no active job", http.StatusNotFound)
 		return
 	}
+	if err := jobid.Validate(jobID); err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
 
-	ctx, cancel := context.WithCancel(r.Context())
+	ctx, cancel := g.untilShutdown(logging.WithJob(r.Context(), jobID))
 	defer cancel()
 
 	stream, err := g.client.StreamStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: jobID})
 	if err != nil {
-		log.Printf("stream status failed id=%s err=%v", jobID, err)
+		slog.ErrorContext(ctx, "stream status failed", "err", err)
 		http.Error(w, "failed to stream events", http.StatusBadGateway)
 		return
 	}
 
+	keepOpen(w)
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -299,7 +580,12 @@ func (g *gateway) handleEvents(w http.ResponseWriter, r *http.Request) {
 	for {
 		event, err := stream.Recv()
 		if err != nil {
-			log.Printf("stream receive ended id=%s err=%v", jobID, err)
+			if g.shutdown.Err() != nil {
+				// EventSource clients reconnect on their own after this.
+				_, _ = w.Write([]byte("event: shutdown\ndata: {\"message\":\"gateway shutting down\"}\n\n"))
+				flusher.Flush()
+			}
+			slog.DebugContext(ctx, "stream receive ended", "err", err)
 			return
 		}
 		payload, _ := json.Marshal(event)
@@ -374,7 +660,7 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		log.Printf("json encode error: %v", err)
+		slog.Error("json encode error", "err", err)
 	}
 }
 
@@ -382,21 +668,51 @@ func logRequests(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
+		slog.InfoContext(r.Context(), "http request", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
 	})
 }
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
+// routeLabels are the fixed paths reported as their own metrics route.
+var routeLabels = map[string]bool{
+	"/v1/nodes":             true,
+	"/v1/checkpoints":       true,
+	"/v1/workflows":         true,
+	"/v1/workflows/extract": true,
+	"/v1/jobs":              true,
+	"/v1/events":            true,
+	"/v1/session":           true,
+	"/v1/auth/token":        true,
+	"/v1/ws":                true,
+	"/metrics":              true,
+	"/healthz":              true,
+	"/readyz":               true,
+}
+
+// jobRouteSuffixes are the sub-resources served under /v1/jobs/<id>.
+var jobRouteSuffixes = map[string]bool{"output": true, "timeline": true, "logs": true}
+
+// routeLabel maps a request to a bounded metrics route. Known paths keep
+// their own series, ids are collapsed, and everything else, including
+// unauthenticated requests for arbitrary paths, is counted as "other".
+func routeLabel(r *http.Request) string {
+	path := r.URL.Path
+	if routeLabels[path] {
+		return path
+	}
+	if label, ok := comfyRouteLabel(path); ok {
+		return label
+	}
+	if rest, ok := strings.CutPrefix(path, "/v1/jobs/"); ok && rest != "" {
+		id, suffix, nested := strings.Cut(rest, "/")
+		switch {
+		case id == "":
+		case !nested:
+			return "/v1/jobs/:id"
+		case jobRouteSuffixes[suffix]:
+			return "/v1/jobs/:id/" + suffix
 		}
-		next.ServeHTTP(w, r)
-	})
+	}
+	return "other"
 }
 
 func envOrDefault(key, fallback string) string {
@@ -415,6 +731,15 @@ func envInt64OrDefault(key string, fallback int64) int64 {
 	return fallback
 }
 
+func envDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
 func parseTokenList(raw string) []string {
 	if raw == "" {
 		return nil
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"comfy-service-tests/internal/auth"
+	"comfy-service-tests/internal/orchestrator"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeOrchestrator keeps submitted jobs as summaries, oldest first, and hands
+// out status streams that the test feeds through their events channel.
+type fakeOrchestrator struct {
+	orchestratorv1.OrchestratorClient
+
+	mu        sync.Mutex
+	workflows []*orchestratorv1.WorkflowSummary
+	streams   []*fakeEventStream
+	// submitErr, when set, is returned by ExecuteWorkflow.
+	submitErr error
+}
+
+func (f *fakeOrchestrator) ExecuteWorkflow(ctx context.Context, req *orchestratorv1.ExecuteWorkflowRequest, _ ...grpc.CallOption) (*orchestratorv1.ExecuteWorkflowResponse, error) {
+	if f.submitErr != nil {
+		return nil, f.submitErr
+	}
+	id := f.add("queued", req.Metadata[orchestrator.MetadataSubmittedBy])
+	return &orchestratorv1.ExecuteWorkflowResponse{WorkflowId: id}, nil
+}
+
+// add records a job as if submitted by submittedBy and returns its id.
+func (f *fakeOrchestrator) add(state, submittedBy string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("job-%d", len(f.workflows)+1)
+	f.workflows = append(f.workflows, &orchestratorv1.WorkflowSummary{WorkflowId: id, State: state, SubmittedBy: submittedBy})
+	return id
+}
+
+func (f *fakeOrchestrator) setState(id, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, workflow := range f.workflows {
+		if workflow.WorkflowId == id {
+			workflow.State = state
+		}
+	}
+}
+
+func (f *fakeOrchestrator) ListWorkflows(ctx context.Context, req *orchestratorv1.ListWorkflowsRequest, _ ...grpc.CallOption) (*orchestratorv1.ListWorkflowsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &orchestratorv1.ListWorkflowsResponse{}
+	for i := len(f.workflows) - 1; i >= 0; i-- {
+		if req.State == "" || f.workflows[i].State == req.State {
+			resp.Workflows = append(resp.Workflows, f.workflows[i])
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeOrchestrator) GetWorkflowStatus(ctx context.Context, req *orchestratorv1.StatusRequest, _ ...grpc.CallOption) (*orchestratorv1.StatusResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, workflow := range f.workflows {
+		if workflow.WorkflowId == req.WorkflowId {
+			return &orchestratorv1.StatusResponse{WorkflowId: workflow.WorkflowId, State: workflow.State}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "workflow not found")
+}
+
+func (f *fakeOrchestrator) ListNodes(ctx context.Context, req *orchestratorv1.ListNodesRequest, _ ...grpc.CallOption) (*orchestratorv1.ListNodesResponse, error) {
+	return &orchestratorv1.ListNodesResponse{Nodes: []*orchestratorv1.NodeDefinition{
+		{Name: "KSampler", Category: "sampling", Outputs: map[string]string{"LATENT": "LATENT"}},
+	}}, nil
+}
+
+func (f *fakeOrchestrator) StreamStatus(ctx context.Context, req *orchestratorv1.StatusRequest, _ ...grpc.CallOption) (orchestratorv1.Orchestrator_StreamStatusClient, error) {
+	stream := &fakeEventStream{ctx: ctx, events: make(chan *orchestratorv1.StatusEvent)}
+	f.mu.Lock()
+	f.streams = append(f.streams, stream)
+	f.mu.Unlock()
+	return stream, nil
+}
+
+func (f *fakeOrchestrator) stream(i int) *fakeEventStream {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i >= len(f.streams) {
+		return nil
+	}
+	return f.streams[i]
+}
+
+type fakeEventStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events chan *orchestratorv1.StatusEvent
+}
+
+func (f *fakeEventStream) Recv() (*orchestratorv1.StatusEvent, error) {
+	select {
+	case event := <-f.events:
+		return event, nil
+	case <-f.ctx.Done():
+		return nil, f.ctx.Err()
+	}
+}
+
+func newTestGateway(client orchestratorv1.OrchestratorClient) *gateway {
+	return &gateway{
+		client:   client,
+		cors:     &corsPolicy{},
+		sessions: newSessionStore(),
+		shutdown: context.Background(),
+	}
+}
+
+// as authenticates r as subject, as auth.Middleware would.
+func as(r *http.Request, subject string) *http.Request {
+	return r.WithContext(auth.WithIdentity(r.Context(), auth.Identity{Subject: subject, Method: "api_key"}))
+}
+
+func waitFor(t *testing.T, timeout time.Duration, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if fn() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("condition not met within %v", timeout)
+}
+
+func TestRouteLabelCollapsesIDs(t *testing.T) {
+	for path, want := range map[string]string{
+		"/v1/workflows":             "/v1/workflows",
+		"/v1/jobs":                  "/v1/jobs",
+		"/v1/jobs/job-1":            "/v1/jobs/:id",
+		"/v1/jobs/job-1/output":     "/v1/jobs/:id/output",
+		"/v1/jobs/job-2/logs":       "/v1/jobs/:id/logs",
+		"/v1/jobs/job-1/unknown":    "other",
+		"/v1/jobs//output":          "other",
+		"/history":                  "/history",
+		"/history/job-1":            "/history/:id",
+		"/api/history/job-1":        "/api/history/:id",
+		"/api/object_info/KSampler": "/api/object_info/:node",
+		"/api/ws":                   "/api/ws",
+		"/api/history/job-1/extra":  "other",
+		"/view/anything":            "other",
+		"/wp-login.php":             "other",
+		"/api/../../etc/passwd":     "other",
+	} {
+		if got := routeLabel(httptest.NewRequest(http.MethodGet, "http://gateway"+path, nil)); got != want {
+			t.Errorf("routeLabel(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"comfy-service-tests/internal/auth"
+	"comfy-service-tests/internal/metrics"
+	"comfy-service-tests/internal/orchestrator"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxRateBuckets bounds the callers tracked; full (idle) buckets are
+	// dropped first since they carry no state.
+	maxRateBuckets = 10000
+	// quotaRetryAfter is suggested to callers at their active-job quota.
+	quotaRetryAfter = 10 * time.Second
+)
+
+var submissionsRejected = metrics.Default.NewCounter("comfy_gateway_submissions_rejected_total", "Workflow submissions refused with 429, by reason.", "reason")
+
+// rateLimiter is a token bucket per caller: burst submissions at once, then
+// one every interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	buckets  map[string]*bucket
+	now      func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter allows perMinute submissions a minute after an initial
+// burst. It returns nil, meaning unlimited, when perMinute is not positive.
+func newRateLimiter(perMinute float64, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Minute) / perMinute),
+		burst:    float64(burst),
+		buckets:  make(map[string]*bucket),
+		now:      time.Now,
+	}
+}
+
+// allow takes a token for key. When none is left it reports how long until
+// the next one.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.pruneLocked(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * float64(l.interval))
+}
+
+func (l *rateLimiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+float64(elapsed)/float64(l.interval))
+		b.last = now
+	}
+}
+
+// pruneLocked drops buckets that have refilled completely, and all of them
+// if that frees nothing. Callers hold l.mu.
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets) >= maxRateBuckets {
+		l.buckets = make(map[string]*bucket)
+	}
+}
+
+// submissionLimits throttles workflow submissions per caller.
+type submissionLimits struct {
+	rate *rateLimiter
+	// maxActiveJobs is the default quota of queued plus running jobs per
+	// caller; API keys may override it. 0 disables quotas.
+	maxActiveJobs int
+}
+
+// loadSubmissionLimits reads SUBMIT_RATE_PER_MINUTE, SUBMIT_BURST and
+// SUBMIT_MAX_ACTIVE_JOBS.
+func loadSubmissionLimits() submissionLimits {
+	return submissionLimits{
+		rate:          newRateLimiter(float64(envInt64OrDefault("SUBMIT_RATE_PER_MINUTE", 30)), int(envInt64OrDefault("SUBMIT_BURST", 10))),
+		maxActiveJobs: int(envInt64OrDefault("SUBMIT_MAX_ACTIVE_JOBS", 10)),
+	}
+}
+
+// callerKey identifies the submitter for limits and job attribution: the
+// authenticated subject, else the client address.
+func callerKey(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return id.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// admitSubmission applies the caller's rate limit. When it is exhausted it
+// returns false and how long the caller should wait.
+func (g *gateway) admitSubmission(r *http.Request) (bool, time.Duration) {
+	key := callerKey(r)
+	ok, wait := g.limits.rate.allow(key)
+	if !ok {
+		submissionsRejected.Inc("rate")
+		slog.WarnContext(r.Context(), "submission rate limited", "caller", key, "retry_after", wait)
+	}
+	return ok, wait
+}
+
+// withQuota sets the caller's active-job quota in workflow metadata; the
+// orchestrator enforces it against its job table.
+func (g *gateway) withQuota(r *http.Request, metadata map[string]string) map[string]string {
+	limit := g.limits.maxActiveJobs
+	if id, ok := auth.FromContext(r.Context()); ok && id.MaxActiveJobs > 0 {
+		limit = id.MaxActiveJobs
+	}
+	if limit > 0 {
+		metadata[orchestrator.MetadataMaxActiveJobs] = strconv.Itoa(limit)
+	}
+	return metadata
+}
+
+// quotaExceeded reports whether err is the orchestrator refusing a job
+// because the caller is at its quota.
+func quotaExceeded(err error) (string, bool) {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.ResourceExhausted {
+		submissionsRejected.Inc("quota")
+		return st.Message(), true
+	}
+	return "", false
+}
+
+// setRetryAfter writes a Retry-After header in whole seconds, rounding up.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
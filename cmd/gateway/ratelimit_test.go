@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubmissionRateLimitSetsRetryAfter(t *testing.T) {
+	g := newTestGateway(&fakeOrchestrator{})
+	now := time.Unix(1700000000, 0)
+	g.limits.rate = newRateLimiter(6, 1)
+	g.limits.rate.now = func() time.Time { return now }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/workflows", g.handleWorkflows)
+	newComfyCompat(g).register(mux)
+
+	submit := func(path, body, subject string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, as(httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)), subject))
+		return rec
+	}
+	graph := `{"3": {"class_type": "KSampler", "inputs": {}}}`
+	if rec := submit("/v1/workflows", graph, "alice"); rec.Code != http.StatusAccepted {
+		t.Fatalf("first submission: status %d", rec.Code)
+	}
+	for _, tc := range []struct{ path, body string }{
+		{"/v1/workflows", graph},
+		{"/prompt", `{"prompt": ` + graph + `}`},
+	} {
+		rec := submit(tc.path, tc.body, "alice")
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "10" {
+			t.Errorf("%s over the limit: status %d, Retry-After %q, want 429 and 10", tc.path, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	if rec := submit("/v1/workflows", graph, "bob"); rec.Code != http.StatusAccepted {
+		t.Fatalf("another caller's submission: status %d", rec.Code)
+	}
+
+	now = now.Add(4 * time.Second)
+	if rec := submit("/v1/workflows", graph, "alice"); rec.Header().Get("Retry-After") != "6" {
+		t.Errorf("Retry-After after 4s = %q, want 6", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestActiveJobQuotaSetsRetryAfter(t *testing.T) {
+	g := newTestGateway(&fakeOrchestrator{submitErr: status.Error(codes.ResourceExhausted, "active job quota of 2 reached")})
+	rec := httptest.NewRecorder()
+	g.handleWorkflows(rec, as(httptest.NewRequest(http.MethodPost, "/v1/workflows", strings.NewReader(`{"3": {"class_type": "KSampler", "inputs": {}}}`)), "alice"))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "10" {
+		t.Fatalf("quota exceeded: status %d, Retry-After %q, want 429 and 10", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), "quota") {
+		t.Fatalf("quota exceeded body = %q", rec.Body)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// certCheckInterval bounds how often handshakes stat the certificate files.
+const certCheckInterval = 10 * time.Second
+
+// listenerConfig is how the gateway serves HTTP: plaintext or TLS, and the
+// server timeouts.
+type listenerConfig struct {
+	certFile string
+	keyFile  string
+	// h2c enables cleartext HTTP/2 for deployments behind a TLS-terminating
+	// proxy. TLS listeners negotiate HTTP/2 through ALPN regardless.
+	h2c               bool
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+}
+
+// loadListenerConfig reads GATEWAY_TLS_CERT, GATEWAY_TLS_KEY, GATEWAY_H2C and
+// GATEWAY_{READ_HEADER,READ,WRITE,IDLE}_TIMEOUT. A zero timeout disables it.
+func loadListenerConfig() (listenerConfig, error) {
+	cfg := listenerConfig{
+		certFile:          os.Getenv("GATEWAY_TLS_CERT"),
+		keyFile:           os.Getenv("GATEWAY_TLS_KEY"),
+		h2c:               isTruthy(os.Getenv("GATEWAY_H2C")),
+		readHeaderTimeout: envDurationOrDefault("GATEWAY_READ_HEADER_TIMEOUT", 10*time.Second),
+		readTimeout:       envDurationOrDefault("GATEWAY_READ_TIMEOUT", time.Minute),
+		writeTimeout:      envDurationOrDefault("GATEWAY_WRITE_TIMEOUT", 2*time.Minute),
+		idleTimeout:       envDurationOrDefault("GATEWAY_IDLE_TIMEOUT", 2*time.Minute),
+	}
+	if (cfg.certFile == "") != (cfg.keyFile == "") {
+		return listenerConfig{}, errors.New("GATEWAY_TLS_CERT and GATEWAY_TLS_KEY must be set together")
+	}
+	if cfg.tls() && cfg.h2c {
+		return listenerConfig{}, errors.New("GATEWAY_H2C only applies to plaintext listeners")
+	}
+	return cfg, nil
+}
+
+func (c listenerConfig) tls() bool {
+	return c.certFile != ""
+}
+
+// mode describes the listener for startup logs.
+func (c listenerConfig) mode() string {
+	switch {
+	case c.tls():
+		return "tls"
+	case c.h2c:
+		return "h2c"
+	}
+	return "plaintext"
+}
+
+// newServer builds the gateway's http.Server. The write timeout covers
+// ordinary responses; streaming handlers lift it with keepOpen.
+func (c listenerConfig) newServer(addr string, handler http.Handler) (*http.Server, error) {
+	if c.h2c {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: c.idleTimeout})
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: c.readHeaderTimeout,
+		ReadTimeout:       c.readTimeout,
+		WriteTimeout:      c.writeTimeout,
+		IdleTimeout:       c.idleTimeout,
+	}
+	if c.tls() {
+		certs, err := newCertReloader(c.certFile, c.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		}
+	}
+	return srv, nil
+}
+
+// serve runs srv until it fails. HTTP/2 is negotiated automatically on TLS.
+func (c listenerConfig) serve(srv *http.Server) error {
+	if c.tls() {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// run serves srv until ctx is done, then shuts it down: the listener closes,
+// and in-flight requests get up to timeout before connections are cut.
+func (c listenerConfig) run(ctx context.Context, srv *http.Server, timeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- c.serve(srv) }()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	slog.Info("gateway shutting down", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		_ = srv.Close()
+		return err
+	}
+	return nil
+}
+
+// untilShutdown derives a context that also ends when the gateway starts
+// shutting down, for handlers that would otherwise hold Shutdown open.
+func (g *gateway) untilShutdown(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(g.shutdown, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// certReloader serves a certificate from disk and picks up replacements, so
+// renewed certificates apply without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the key pair and records the files' modification times.
+func (r *certReloader) load() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+func (r *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// getCertificate is the tls.Config hook. At most every certCheckInterval it
+// reloads the pair if either file changed; a failed reload (for example a
+// half-written renewal) keeps serving the previous certificate.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.checked) >= certCheckInterval {
+		r.checked = now
+		certMod, keyMod, err := r.modTimes()
+		if err == nil && (!certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)) {
+			err = r.load()
+			if err == nil {
+				slog.Info("reloaded TLS certificate", "cert", r.certFile)
+			}
+		}
+		if err != nil {
+			slog.Warn("TLS certificate reload failed; serving the previous certificate", "err", err)
+		}
+	}
+	return r.cert, nil
+}
+
+// keepOpen lifts the server's read and write deadlines for a long-lived
+// response such as an SSE stream or a WebSocket.
+func keepOpen(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Debug("clear write deadline failed", "err", err)
+	}
+	if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Debug("clear read deadline failed", "err", err)
+	}
+}
+
+// longLived wraps handlers whose responses outlive the write timeout.
+func longLived(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keepOpen(w)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"comfy-service-tests/internal/auth"
+)
+
+const (
+	// sessionCookie carries the client id when requests do not pass client_id.
+	sessionCookie = "comfy_client_id"
+	// sessionTTL is how long an idle session and its cookie are kept.
+	sessionTTL = 24 * time.Hour
+	// maxSessions bounds the sessions held in gateway memory; the least
+	// recently seen is dropped first.
+	maxSessions = 10000
+	// maxSessionJobs bounds the job history kept per session.
+	maxSessionJobs = 100
+	// maxClientIDLength caps client ids taken from query strings and cookies.
+	maxClientIDLength = 128
+)
+
+// errSessionOwner is returned for a client id whose session was created
+// under another credential, so one key cannot read another's session.
+var errSessionOwner = errors.New("client id belongs to another principal")
+
+// session is one client's view of the gateway: the jobs it submitted, oldest
+// first, so the last entry is its current job. principal is the subject that
+// created it ("" when the gateway runs without auth).
+type session struct {
+	principal string
+	jobs      []string
+	lastSeen  time.Time
+}
+
+// sessionStore scopes the "current job" used by /v1/jobs and /v1/events to a
+// client, keyed by the same client id ComfyUI clients send as client_id.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	now      func() time.Time
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*session), now: time.Now}
+}
+
+// check reports errSessionOwner if clientID's session belongs to another
+// principal. Submission handlers call it before creating a job.
+func (s *sessionStore) check(clientID, principal string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.lookupLocked(clientID, principal)
+	return err
+}
+
+// record appends a submitted job to the client's history, creating the
+// session for principal if it does not exist.
+func (s *sessionStore) record(clientID, principal, jobID string) error {
+	if clientID == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	sess, err := s.lookupLocked(clientID, principal)
+	if err != nil {
+		return err
+	}
+	if sess == nil {
+		s.evictLocked(now)
+		sess = &session{principal: principal}
+		s.sessions[clientID] = sess
+	}
+	sess.lastSeen = now
+	sess.jobs = append(sess.jobs, jobID)
+	if len(sess.jobs) > maxSessionJobs {
+		sess.jobs = append([]string(nil), sess.jobs[len(sess.jobs)-maxSessionJobs:]...)
+	}
+	return nil
+}
+
+// current returns the client's most recent job, or "" if it has none.
+func (s *sessionStore) current(clientID, principal string) (string, error) {
+	jobs, err := s.history(clientID, principal)
+	if len(jobs) == 0 {
+		return "", err
+	}
+	return jobs[len(jobs)-1], nil
+}
+
+// history returns a copy of the client's jobs, oldest first.
+func (s *sessionStore) history(clientID, principal string) ([]string, error) {
+	if clientID == "" {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, err := s.lookupLocked(clientID, principal)
+	if sess == nil {
+		return nil, err
+	}
+	sess.lastSeen = s.now()
+	return append([]string(nil), sess.jobs...), nil
+}
+
+// lookupLocked returns clientID's live session, dropping it if expired, or
+// errSessionOwner if principal did not create it. Callers hold s.mu.
+func (s *sessionStore) lookupLocked(clientID, principal string) (*session, error) {
+	sess, ok := s.sessions[clientID]
+	if !ok {
+		return nil, nil
+	}
+	if s.now().Sub(sess.lastSeen) > sessionTTL {
+		delete(s.sessions, clientID)
+		return nil, nil
+	}
+	if sess.principal != principal {
+		return nil, errSessionOwner
+	}
+	return sess, nil
+}
+
+// evictLocked drops expired sessions and, if still full, the least recently
+// seen one. Callers hold s.mu.
+func (s *sessionStore) evictLocked(now time.Time) {
+	if len(s.sessions) < maxSessions {
+		return
+	}
+	oldestID := ""
+	var oldest time.Time
+	for id, sess := range s.sessions {
+		if now.Sub(sess.lastSeen) > sessionTTL {
+			delete(s.sessions, id)
+			continue
+		}
+		if oldestID == "" || sess.lastSeen.Before(oldest) {
+			oldestID, oldest = id, sess.lastSeen
+		}
+	}
+	if len(s.sessions) >= maxSessions {
+		delete(s.sessions, oldestID)
+	}
+}
+
+type sessionResponse struct {
+	ClientID string   `json:"client_id"`
+	Current  string   `json:"current,omitempty"`
+	Jobs     []string `json:"jobs"`
+}
+
+// handleSession serves GET /v1/session: the caller's client id and the jobs
+// it submitted, newest first.
+func (g *gateway) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := ensureClientID(w, r)
+	history, err := g.sessions.history(id, sessionPrincipal(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	jobs := make([]string, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		jobs = append(jobs, history[i])
+	}
+	resp := sessionResponse{ClientID: id, Jobs: jobs}
+	if len(jobs) > 0 {
+		resp.Current = jobs[0]
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// sessionPrincipal is the subject sessions are bound to: the authenticated
+// caller, or "" when the gateway runs without auth.
+func sessionPrincipal(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return id.Subject
+	}
+	return ""
+}
+
+// clientID reads the caller's client id from the client_id query parameter,
+// falling back to the session cookie. It returns "" when neither holds a
+// valid id.
+func clientID(r *http.Request) string {
+	id := r.URL.Query().Get("client_id")
+	if id == "" {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			id = cookie.Value
+		}
+	}
+	if !validClientID(id) {
+		return ""
+	}
+	return id
+}
+
+// validClientID accepts the UUIDs and hex ids clients generate, and rejects
+// anything that cannot be stored in a cookie as-is.
+func validClientID(id string) bool {
+	if id == "" || len(id) > maxClientIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ensureClientID returns the caller's client id, issuing a new one in the
+// session cookie when the request carried none. The cookie is Secure on TLS
+// connections.
+func ensureClientID(w http.ResponseWriter, r *http.Request) string {
+	id := clientID(r)
+	if id == "" {
+		id = newClientID()
+	}
+	if cookie, err := r.Cookie(sessionCookie); err != nil || cookie.Value != id {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    id,
+			Path:     "/",
+			MaxAge:   int(sessionTTL / time.Second),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return id
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionCookieRejectedForAnotherPrincipal(t *testing.T) {
+	g := newTestGateway(&fakeOrchestrator{})
+	graph := `{"3": {"class_type": "KSampler", "inputs": {}}}`
+
+	rec := httptest.NewRecorder()
+	g.handleWorkflows(rec, as(httptest.NewRequest(http.MethodPost, "/v1/workflows", strings.NewReader(graph)), "alice"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("alice's submission: status %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+	withCookie := func(r *http.Request) *http.Request {
+		r.AddCookie(cookies[0])
+		return r
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		req     *http.Request
+	}{
+		{"submit", g.handleWorkflows, httptest.NewRequest(http.MethodPost, "/v1/workflows", strings.NewReader(graph))},
+		{"current job", g.handleJobIndex, httptest.NewRequest(http.MethodGet, "/v1/jobs", nil)},
+		{"session", g.handleSession, httptest.NewRequest(http.MethodGet, "/v1/session", nil)},
+	} {
+		rec := httptest.NewRecorder()
+		tc.handler(rec, as(withCookie(tc.req), "bob"))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s with alice's cookie as bob: status %d, want 403", tc.name, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	g.handleJobIndex(rec, as(withCookie(httptest.NewRequest(http.MethodGet, "/v1/jobs", nil)), "alice"))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"job-1"`) {
+		t.Fatalf("alice's current job: status %d: %s", rec.Code, rec.Body)
+	}
+}
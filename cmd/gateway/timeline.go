@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"comfy-service-tests/internal/logging"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+)
+
+type timelineSpan struct {
+	Name       string `json:"name"`
+	Parent     string `json:"parent,omitempty"`
+	StartMs    int64  `json:"start_ms"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type timelineResponse struct {
+	ID          string         `json:"id"`
+	Status      string         `json:"status"`
+	SubmittedAt string         `json:"submitted_at,omitempty"`
+	TotalMs     int64          `json:"total_ms"`
+	Spans       []timelineSpan `json:"spans"`
+}
+
+func (g *gateway) handleJobTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := jobIDFromPath(w, r, "/timeline")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(logging.WithJob(r.Context(), id), 5*time.Second)
+	defer cancel()
+
+	resp, err := g.client.GetWorkflowStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: id})
+	if err != nil {
+		slog.ErrorContext(ctx, "get timeline failed", "err", err)
+		http.Error(w, "failed to get timeline", http.StatusBadGateway)
+		return
+	}
+	if resp.Timing == nil {
+		http.Error(w, "timeline not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildTimeline(resp))
+}
+
+// buildTimeline flattens job timing into spans with offsets relative to submission.
+func buildTimeline(resp *orchestratorv1.StatusResponse) timelineResponse {
+	timing := resp.GetTiming()
+	out := timelineResponse{
+		ID:      resp.GetWorkflowId(),
+		Status:  resp.GetState(),
+		TotalMs: timing.GetTotalMs(),
+		Spans:   []timelineSpan{},
+	}
+	origin := timing.GetSubmittedAtUnixMs()
+	if origin == 0 {
+		return out
+	}
+	out.SubmittedAt = time.UnixMilli(origin).UTC().Format(time.RFC3339Nano)
+
+	out.Spans = append(out.Spans,
+		timelineSpan{Name: "job", DurationMs: timing.GetTotalMs()},
+		timelineSpan{Name: "queue", Parent: "job", DurationMs: timing.GetQueueWaitMs()},
+	)
+
+	for i, stage := range timing.GetStages() {
+		name := fmt.Sprintf("stage:%s", stage.GetNodeType())
+		if len(timing.GetStages()) > 1 {
+			name = fmt.Sprintf("%s#%d", name, i+1)
+		}
+		out.Spans = append(out.Spans, timelineSpan{
+			Name:       name,
+			Parent:     "job",
+			StartMs:    offsetMillis(origin, stage.GetStartedAtUnixMs()),
+			DurationMs: stage.GetDurationMs(),
+		})
+		for _, attempt := range stage.GetAttempts() {
+			out.Spans = append(out.Spans, timelineSpan{
+				Name:       fmt.Sprintf("%s/attempt-%d", name, attempt.GetAttempt()),
+				Parent:     name,
+				StartMs:    offsetMillis(origin, attempt.GetStartedAtUnixMs()),
+				DurationMs: attempt.GetDurationMs(),
+				Error:      attempt.GetError(),
+			})
+		}
+	}
+
+	return out
+}
+
+func offsetMillis(origin, value int64) int64 {
+	if value < origin {
+		return 0
+	}
+	return value - origin
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"comfy-service-tests/internal/jobid"
+	"comfy-service-tests/internal/logging"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// wsHeartbeat is how often /v1/ws sends a ping. Connections that send
+	// nothing (not even a pong) for two intervals are closed.
+	wsHeartbeat = 25 * time.Second
+	// maxWSSubscriptions bounds the jobs one connection can watch.
+	maxWSSubscriptions = 64
+)
+
+// wsClientMessage is sent by /v1/ws clients:
+// {"type": "subscribe"|"unsubscribe", "id": "<job>"} or {"type": "ping"|"pong"}.
+type wsClientMessage struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// wsServerMessage carries job events as {"type": "status", "id", "event"}, where
+// event has the StatusEvent shape also used by /v1/events, plus subscription
+// acknowledgements, errors, heartbeats and a final {"type": "shutdown"}.
+type wsServerMessage struct {
+	Type  string                      `json:"type"`
+	ID    string                      `json:"id,omitempty"`
+	Event *orchestratorv1.StatusEvent `json:"event,omitempty"`
+	Error string                      `json:"error,omitempty"`
+	Time  int64                       `json:"time,omitempty"`
+}
+
+type eventSocket struct {
+	g    *gateway
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	subs     map[string]*wsSubscription
+	watchers sync.WaitGroup
+}
+
+// wsSubscription is one watcher for a job. Its pointer identifies the
+// watcher, so a finished watcher never removes a later resubscription.
+type wsSubscription struct {
+	cancel context.CancelFunc
+}
+
+func (s *eventSocket) send(msg wsServerMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return websocket.JSON.Send(s.conn, msg)
+}
+
+// serveEventSocket multiplexes status events for many jobs over one
+// WebSocket connection.
+func (g *gateway) serveEventSocket(conn *websocket.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	socket := &eventSocket{g: g, conn: conn, subs: make(map[string]*wsSubscription)}
+	defer func() {
+		cancel()
+		socket.watchers.Wait()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(wsHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-g.shutdown.Done():
+				// Closing the connection also ends the read loop below.
+				_ = socket.send(wsServerMessage{Type: "shutdown", Time: time.Now().UnixMilli()})
+				_ = conn.Close()
+				return
+			case now := <-ticker.C:
+				if socket.send(wsServerMessage{Type: "ping", Time: now.UnixMilli()}) != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * wsHeartbeat))
+		var msg wsClientMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				_ = socket.send(wsServerMessage{Type: "error", Error: "invalid message"})
+				continue
+			}
+			slog.DebugContext(ctx, "event socket closed", "err", err)
+			return
+		}
+
+		switch msg.Type {
+		case "subscribe":
+			socket.subscribe(ctx, msg.ID)
+		case "unsubscribe":
+			socket.unsubscribe(msg.ID)
+			_ = socket.send(wsServerMessage{Type: "unsubscribed", ID: msg.ID})
+		case "ping":
+			_ = socket.send(wsServerMessage{Type: "pong", Time: time.Now().UnixMilli()})
+		case "pong":
+		default:
+			_ = socket.send(wsServerMessage{Type: "error", Error: "unknown message type " + msg.Type})
+		}
+	}
+}
+
+func (s *eventSocket) subscribe(ctx context.Context, id string) {
+	if err := jobid.Validate(id); err != nil {
+		_ = s.send(wsServerMessage{Type: "error", ID: id, Error: "invalid job id"})
+		return
+	}
+	s.mu.Lock()
+	if _, ok := s.subs[id]; ok {
+		s.mu.Unlock()
+		_ = s.send(wsServerMessage{Type: "subscribed", ID: id})
+		return
+	}
+	if len(s.subs) >= maxWSSubscriptions {
+		s.mu.Unlock()
+		_ = s.send(wsServerMessage{Type: "error", ID: id, Error: "too many subscriptions"})
+		return
+	}
+	watchCtx, cancel := context.WithCancel(logging.WithJob(ctx, id))
+	sub := &wsSubscription{cancel: cancel}
+	s.subs[id] = sub
+	s.watchers.Add(1)
+	s.mu.Unlock()
+
+	_ = s.send(wsServerMessage{Type: "subscribed", ID: id})
+	go func() {
+		defer s.watchers.Done()
+		defer s.release(id, sub)
+		s.watch(watchCtx, id)
+	}()
+}
+
+func (s *eventSocket) unsubscribe(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subs[id]; ok {
+		sub.cancel()
+		delete(s.subs, id)
+	}
+}
+
+// release ends sub and removes it unless id has since been resubscribed.
+func (s *eventSocket) release(id string, sub *wsSubscription) {
+	sub.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[id] == sub {
+		delete(s.subs, id)
+	}
+}
+
+// watch forwards one job's events until it finishes or is unsubscribed.
+func (s *eventSocket) watch(ctx context.Context, id string) {
+	stream, err := s.g.client.StreamStatus(ctx, &orchestratorv1.StatusRequest{WorkflowId: id})
+	if err != nil {
+		slog.ErrorContext(ctx, "stream status failed", "err", err)
+		_ = s.send(wsServerMessage{Type: "error", ID: id, Error: "failed to stream events"})
+		return
+	}
+	received := false
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if !received && ctx.Err() == nil {
+				_ = s.send(wsServerMessage{Type: "error", ID: id, Error: "job not found"})
+			}
+			slog.DebugContext(ctx, "stream receive ended", "err", err)
+			return
+		}
+		received = true
+		if s.send(wsServerMessage{Type: "status", ID: id, Event: event}) != nil {
+			return
+		}
+		if event.State == "completed" || event.State == "failed" {
+			return
+		}
+	}
+}
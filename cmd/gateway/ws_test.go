@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// dialEventSocket returns the server side of a WebSocket connection whose
+// client side discards everything it receives.
+func dialEventSocket(t *testing.T) *websocket.Conn {
+	t.Helper()
+	conns := make(chan *websocket.Conn)
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		conns <- conn
+		<-done
+	}))
+	client, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(client, &discard) == nil {
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		client.Close()
+		server.Close()
+	})
+	return <-conns
+}
+
+func TestEventSocketStaleWatcherKeepsResubscription(t *testing.T) {
+	fake := &fakeOrchestrator{}
+	socket := &eventSocket{g: newTestGateway(fake), conn: dialEventSocket(t), subs: make(map[string]*wsSubscription)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		socket.watchers.Wait()
+	}()
+
+	current := func() *wsSubscription {
+		socket.mu.Lock()
+		defer socket.mu.Unlock()
+		return socket.subs["job-1"]
+	}
+
+	socket.subscribe(ctx, "job-1")
+	first := current()
+	socket.unsubscribe("job-1")
+	socket.subscribe(ctx, "job-1")
+	second := current()
+	if first == nil || second == nil || first == second {
+		t.Fatalf("expected two distinct subscriptions, got %p and %p", first, second)
+	}
+
+	// The first watcher exits after the second subscription exists.
+	socket.release("job-1", first)
+
+	if current() != second {
+		t.Fatalf("stale watcher removed the resubscription")
+	}
+	waitFor(t, time.Second, func() bool { return fake.stream(1) != nil })
+	if fake.stream(0).ctx.Err() != nil && fake.stream(1).ctx.Err() != nil {
+		t.Fatalf("resubscribed watcher was cancelled")
+	}
+}
@@ -3,63 +3,169 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/grpctls"
+	"comfy-service-tests/internal/jobid"
 	"comfy-service-tests/internal/logging"
+	"comfy-service-tests/internal/metrics"
 	"comfy-service-tests/internal/orchestrator"
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"comfy-service-tests/internal/tracing"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
 	addr := flag.String("addr", ":9090", "gRPC listen address")
+	metricsAddr := flag.String("metrics-addr", envOrDefault("METRICS_ADDR", ":9190"), "Prometheus metrics listen address (empty to disable)")
 	stageAddr := flag.String("stage-addr", envOrDefault("STAGE_SAMPLER_ADDR", "stage-sampler:9091"), "stage sampler address")
+	instance := flag.String("instance", jobid.DefaultInstance(), "workflow id prefix identifying this orchestrator (ORCHESTRATOR_INSTANCE)")
 	artifactsRoot := flag.String("artifacts", envOrDefault("ARTIFACTS_ROOT", "/artifacts"), "artifacts root directory")
 	logDir := flag.String("log-dir", envOrDefault("LOG_DIR", "/logs"), "log directory")
 	stageTimeout := flag.Duration("stage-timeout", envDurationOrDefault("STAGE_TIMEOUT", 2*time.Minute), "stage execution timeout")
 	stageRetries := flag.Int("stage-retries", envIntOrDefault("STAGE_MAX_RETRIES", 2), "stage execution retry count")
 	stageRetryDelay := flag.Duration("stage-retry-delay", envDurationOrDefault("STAGE_RETRY_DELAY", 2*time.Second), "delay between stage retries")
-	stageHealthTimeout := flag.Duration("stage-health-timeout", envDurationOrDefault("STAGE_HEALTH_TIMEOUT", 2*time.Minute), "max time to wait for stage health")
 	stageHealthInterval := flag.Duration("stage-health-interval", envDurationOrDefault("STAGE_HEALTH_INTERVAL", 2*time.Second), "interval between stage health checks")
 	stageHealthRequestTimeout := flag.Duration("stage-health-request-timeout", envDurationOrDefault("STAGE_HEALTH_REQUEST_TIMEOUT", 5*time.Second), "timeout per stage health request")
+	stageUnhealthyThreshold := flag.Int("stage-unhealthy-threshold", envIntOrDefault("STAGE_UNHEALTHY_THRESHOLD", 3), "consecutive failed stage health checks before the stage is marked unavailable")
+	drainTimeout := flag.Duration("drain-timeout", envDurationOrDefault("DRAIN_TIMEOUT", 2*time.Minute), "how long shutdown waits for running jobs before interrupting them")
 	flag.Parse()
 
 	if _, err := logging.Setup("orchestrator", *logDir); err != nil {
 		log.Fatalf("failed to set up logging: %v", err)
 	}
-	log.Printf("starting orchestrator addr=%s stage=%s artifacts=%s", *addr, *stageAddr, *artifactsRoot)
+	tracer, err := tracing.Setup("orchestrator", *logDir)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	slog.Info("starting orchestrator", "addr", *addr, "stage", *stageAddr, "artifacts", *artifactsRoot)
 
 	listener, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatalf("failed to listen on %s: %v", *addr, err)
 	}
 
-	conn, err := grpc.Dial(*stageAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// One certificate serves both roles: listener for the gateway and client
+	// of the stage service.
+	tlsConfig, err := grpctls.FromEnv()
+	if err != nil {
+		log.Fatalf("invalid gRPC TLS configuration: %v", err)
+	}
+	dialCreds, err := tlsConfig.DialOption()
+	if err != nil {
+		log.Fatalf("failed to load gRPC TLS credentials: %v", err)
+	}
+	serverCreds, err := tlsConfig.ServerOption()
+	if err != nil {
+		log.Fatalf("failed to load gRPC TLS credentials: %v", err)
+	}
+
+	// Cap reconnect backoff so a restarted stage is seen within a few
+	// health intervals rather than after gRPC's default two minutes.
+	conn, err := grpc.Dial(
+		*stageAddr,
+		dialCreds,
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: time.Second, Multiplier: 1.6, Jitter: 0.2, MaxDelay: 5 * time.Second},
+			MinConnectTimeout: 5 * time.Second,
+		}),
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor(), metrics.UnaryClientInterceptor()),
+	)
 	if err != nil {
 		log.Fatalf("failed to dial stage sampler at %s: %v", *stageAddr, err)
 	}
 
 	stageClient := orchestratorv1.NewStageRunnerClient(conn)
-	if err := waitForStageHealth(stageClient, *stageHealthTimeout, *stageHealthInterval, *stageHealthRequestTimeout); err != nil {
-		log.Fatalf("stage sampler health check failed: %v", err)
-	}
 
-	server := grpc.NewServer()
-	orchestratorv1.RegisterOrchestratorServer(
-		server,
-		orchestrator.NewServer(stageClient, *artifactsRoot, *stageTimeout, *stageRetries, *stageRetryDelay),
+	server := grpc.NewServer(
+		serverCreds,
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor(), metrics.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor(), metrics.StreamServerInterceptor()),
 	)
+	orchestratorServer := orchestrator.NewServer(stageClient, *artifactsRoot, *stageTimeout, *stageRetries, *stageRetryDelay)
+	orchestratorServer.SetInstance(*instance)
+	orchestratorServer.RegisterMetrics(metrics.Default)
+	store, err := artifacts.OpenFromEnv(*artifactsRoot)
+	if err != nil {
+		log.Fatalf("failed to open artifact store: %v", err)
+	}
+	orchestratorServer.SetArtifactStore(store)
+	logging.EnableJobLogs("orchestrator", *artifactsRoot, store)
+	orchestratorv1.RegisterOrchestratorServer(server, orchestratorServer)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	orchestratorServer.SetHealth(healthServer)
+
+	if *metricsAddr != "" {
+		go func() {
+			slog.Info("orchestrator metrics listening", "addr", *metricsAddr)
+			if err := metrics.ListenAndServe(*metricsAddr); err != nil {
+				slog.Error("metrics listener stopped", "err", err)
+			}
+		}()
+	}
 
-	log.Printf("orchestrator gRPC listening on %s", *addr)
-	if err := server.Serve(listener); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go orchestratorServer.MonitorStage(ctx, orchestrator.NewStageCheck(healthpb.NewHealthClient(conn), stageClient), *stageHealthInterval, *stageHealthRequestTimeout, *stageUnhealthyThreshold)
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("orchestrator gRPC listening", "addr", *addr, "tls", tlsConfig.Mode())
+		serveErr <- server.Serve(listener)
+	}()
+	select {
+	case err := <-serveErr:
 		log.Fatalf("orchestrator gRPC stopped: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Keep serving status calls while jobs drain so clients see them finish.
+	slog.Info("orchestrator draining", "timeout", *drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	if err := orchestratorServer.Drain(drainCtx); err != nil {
+		slog.Warn("drain timed out", "err", err)
+	}
+	stopGRPC(server, shutdownGrace)
+	_ = conn.Close()
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := tracer.Shutdown(flushCtx); err != nil {
+		slog.Warn("tracing shutdown failed", "err", err)
+	}
+	slog.Info("orchestrator stopped")
+}
+
+// shutdownGrace bounds GracefulStop once jobs have drained; status streams
+// end within a poll interval of their job finishing.
+const shutdownGrace = 10 * time.Second
+
+// stopGRPC stops accepting RPCs and waits up to grace for running ones
+// before closing them.
+func stopGRPC(server *grpc.Server, grace time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grace):
+		slog.Warn("gRPC graceful stop timed out", "grace", grace)
+		server.Stop()
 	}
 }
 
@@ -87,39 +193,3 @@ func envIntOrDefault(key string, fallback int) int {
 	}
 	return fallback
 }
-
-func waitForStageHealth(client orchestratorv1.StageRunnerClient, timeout, interval, requestTimeout time.Duration) error {
-	if interval <= 0 {
-		interval = 2 * time.Second
-	}
-	if requestTimeout <= 0 {
-		requestTimeout = 5 * time.Second
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	log.Printf("waiting for stage sampler health (timeout=%s)", timeout)
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	var lastErr error
-	for {
-		reqCtx, reqCancel := context.WithTimeout(ctx, requestTimeout)
-		_, err := client.Health(reqCtx, &orchestratorv1.HealthRequest{})
-		reqCancel()
-		if err == nil {
-			log.Printf("stage sampler is healthy")
-			return nil
-		}
-		lastErr = err
-		log.Printf("stage sampler health check failed: %v", err)
-		select {
-		case <-ctx.Done():
-			if lastErr != nil {
-				return fmt.Errorf("last error: %w", lastErr)
-			}
-			return ctx.Err()
-		case <-ticker.C:
-		}
-	}
-}
@@ -2,54 +2,184 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"log"
+	"log/slog"
 	"net"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/grpctls"
 	"comfy-service-tests/internal/imaging"
+	"comfy-service-tests/internal/jobid"
 	"comfy-service-tests/internal/logging"
+	"comfy-service-tests/internal/metrics"
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"comfy-service-tests/internal/tracing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	renderDuration = metrics.Default.NewHistogram("comfy_stage_render_duration_seconds", "Time spent rendering a stage output, by node type.", metrics.DefaultBuckets, "node_type", "status")
+	artifactBytes  = metrics.Default.NewCounter("comfy_stage_artifact_bytes_written_total", "Bytes written to the artifact store, by node type.", "node_type")
 )
 
 type stageServer struct {
 	orchestratorv1.UnimplementedStageRunnerServer
-	artifactsRoot string
+	store artifacts.Store
 }
 
 func main() {
 	addr := flag.String("addr", ":9091", "gRPC listen address")
+	metricsAddr := flag.String("metrics-addr", envOrDefault("METRICS_ADDR", ":9191"), "Prometheus metrics listen address (empty to disable)")
 	artifactsRoot := flag.String("artifacts", envOrDefault("ARTIFACTS_ROOT", "/artifacts"), "artifacts root directory")
+	drainTimeout := flag.Duration("drain-timeout", envDurationOrDefault("DRAIN_TIMEOUT", 2*time.Minute), "how long shutdown waits for running stages")
 	flag.Parse()
 	logDir := envOrDefault("LOG_DIR", ".log")
 
 	if _, err := logging.Setup("stage-sampler", logDir); err != nil {
 		log.Fatalf("failed to set up logging: %v", err)
 	}
+	tracer, err := tracing.Setup("stage-sampler", logDir)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	store, err := artifacts.OpenFromEnv(*artifactsRoot)
+	if err != nil {
+		log.Fatalf("failed to open artifact store: %v", err)
+	}
+	logging.EnableJobLogs("stage-sampler", *artifactsRoot, store)
 
 	listener, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatalf("failed to listen on %s: %v", *addr, err)
 	}
 
-	server := grpc.NewServer()
-	orchestratorv1.RegisterStageRunnerServer(server, &stageServer{artifactsRoot: *artifactsRoot})
+	tlsConfig, err := grpctls.FromEnv()
+	if err != nil {
+		log.Fatalf("invalid gRPC TLS configuration: %v", err)
+	}
+	creds, err := tlsConfig.ServerOption()
+	if err != nil {
+		log.Fatalf("failed to load gRPC TLS credentials: %v", err)
+	}
+
+	server := grpc.NewServer(
+		creds,
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor(), metrics.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor(), metrics.StreamServerInterceptor()),
+	)
+	orchestratorv1.RegisterStageRunnerServer(server, &stageServer{store: store})
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(orchestratorv1.StageRunner_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	if *metricsAddr != "" {
+		go func() {
+			slog.Info("stage-sampler metrics listening", "addr", *metricsAddr)
+			if err := metrics.ListenAndServe(*metricsAddr); err != nil {
+				slog.Error("metrics listener stopped", "err", err)
+			}
+		}()
+	}
 
-	log.Printf("stage-sampler gRPC listening on %s", *addr)
-	if err := server.Serve(listener); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("stage-sampler gRPC listening", "addr", *addr, "tls", tlsConfig.Mode())
+		serveErr <- server.Serve(listener)
+	}()
+	select {
+	case err := <-serveErr:
 		log.Fatalf("stage-sampler gRPC stopped: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("stage-sampler draining", "timeout", *drainTimeout)
+	healthServer.Shutdown()
+	stopGRPC(server, *drainTimeout)
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := tracer.Shutdown(flushCtx); err != nil {
+		slog.Warn("tracing shutdown failed", "err", err)
+	}
+	slog.Info("stage-sampler stopped")
+}
+
+// stopGRPC stops accepting RPCs and waits up to grace for running stages
+// before closing them.
+func stopGRPC(server *grpc.Server, grace time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grace):
+		slog.Warn("gRPC graceful stop timed out", "grace", grace)
+		server.Stop()
 	}
 }
 
 func (s *stageServer) RunStage(ctx context.Context, req *orchestratorv1.StageRequest) (*orchestratorv1.StageResult, error) {
+	// StageId names the output directory, so reject anything that is not a job id.
+	if err := jobid.Validate(req.GetStageId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx = stageLogContext(ctx, req)
+	defer logging.CloseJobLog(ctx, req.StageId)
+	start := time.Now()
+	slog.InfoContext(ctx, "stage started")
+	result, err := s.runStage(ctx, req)
+	renderDuration.Observe(time.Since(start).Seconds(), req.NodeType, result.GetStatus())
+	if result.GetStatus() == "completed" {
+		slog.InfoContext(ctx, "stage completed", "duration", time.Since(start))
+	} else {
+		slog.ErrorContext(ctx, "stage failed", "duration", time.Since(start), "err", result.GetErrorMessage())
+	}
+	return result, err
+}
+
+// stageLogContext attaches job, stage and attempt fields to records logged while serving req.
+func stageLogContext(ctx context.Context, req *orchestratorv1.StageRequest) context.Context {
+	ctx = logging.WithStage(logging.WithJob(ctx, req.StageId), req.NodeType)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(logging.AttemptMetadataKey); len(values) > 0 {
+			if attempt, err := strconv.Atoi(values[0]); err == nil {
+				ctx = logging.WithAttempt(ctx, attempt)
+			}
+		}
+	}
+	return ctx
+}
+
+func (s *stageServer) runStage(ctx context.Context, req *orchestratorv1.StageRequest) (*orchestratorv1.StageResult, error) {
 	width := parseInt(req.Params["width"], 512)
 	height := parseInt(req.Params["height"], 512)
 	seed := parseInt64(req.Params["seed"], 0)
+	format, err := imaging.ParseFormat(req.Params["format"])
+	if err != nil {
+		return &orchestratorv1.StageResult{StageId: req.StageId, Status: "failed", ErrorMessage: err.Error()}, nil
+	}
 
+	_, renderSpan := tracing.Start(ctx, "stage.render")
+	renderSpan.SetAttribute("job.id", req.StageId)
+	renderSpan.SetAttribute("stage.node_type", req.NodeType)
 	payload, err := imaging.RenderPlaceholder(imaging.RenderOptions{
 		Width:      width,
 		Height:     height,
@@ -57,25 +187,38 @@ func (s *stageServer) RunStage(ctx context.Context, req *orchestratorv1.StageReq
 		Negative:   req.Params["negative"],
 		Checkpoint: req.Params["checkpoint"],
 		Seed:       seed,
+		Format:     format,
+		Quality:    parseInt(req.Params["quality"], imaging.DefaultQuality),
+		Text:       provenance(req.Params, seed).TextChunks(),
 	})
+	renderSpan.RecordError(err)
+	renderSpan.End()
 	if err != nil {
 		return &orchestratorv1.StageResult{StageId: req.StageId, Status: "failed", ErrorMessage: err.Error()}, nil
 	}
 
-	outputDir := filepath.Join(s.artifactsRoot, req.StageId)
-	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+	outputKey := req.StageId + "/output." + format.Extension()
+	writeCtx, writeSpan := tracing.Start(ctx, "artifact.write")
+	writeSpan.SetAttribute("artifact.uri", s.store.URI(outputKey))
+	writeSpan.SetAttribute("artifact.bytes", len(payload))
+	stored, err := artifacts.PutBytes(writeCtx, s.store, outputKey, payload, format.ContentType())
+	writeSpan.RecordError(err)
+	writeSpan.End()
+	if err != nil {
 		return &orchestratorv1.StageResult{StageId: req.StageId, Status: "failed", ErrorMessage: err.Error()}, nil
 	}
+	artifactBytes.Add(float64(len(payload)), req.NodeType)
 
-	outputPath := filepath.Join(outputDir, "output.png")
-	if err := os.WriteFile(outputPath, payload, 0o644); err != nil {
+	if err := s.writeMetadata(ctx, req); err != nil {
 		return &orchestratorv1.StageResult{StageId: req.StageId, Status: "failed", ErrorMessage: err.Error()}, nil
 	}
 
 	outputRef := &orchestratorv1.TensorRef{
-		Uri:   outputPath,
-		Shape: []int64{int64(height), int64(width), 3},
-		Dtype: "image/png",
+		Uri:       artifacts.RefURI(outputKey),
+		Shape:     []int64{int64(height), int64(width), 3},
+		Dtype:     format.ContentType(),
+		Digest:    stored.Digest,
+		SizeBytes: stored.Size,
 	}
 
 	return &orchestratorv1.StageResult{
@@ -87,6 +230,36 @@ func (s *stageServer) RunStage(ctx context.Context, req *orchestratorv1.StageReq
 	}, nil
 }
 
+// provenance collects the generation parameters embedded into PNG outputs.
+func provenance(params map[string]string, seed int64) imaging.Provenance {
+	return imaging.Provenance{
+		Positive:   params["positive"],
+		Negative:   params["negative"],
+		Checkpoint: params["checkpoint"],
+		Seed:       seed,
+		Steps:      parseInt(params["steps"], 0),
+		Cfg:        params["cfg"],
+		Sampler:    params["sampler"],
+		Scheduler:  params["scheduler"],
+		Workflow:   params["workflow"],
+		Prompt:     params["prompt"],
+	}
+}
+
+// writeMetadata stores the same side-car metadata.json the Python sampler writes.
+func (s *stageServer) writeMetadata(ctx context.Context, req *orchestratorv1.StageRequest) error {
+	metadata := map[string]string{}
+	for _, key := range []string{"checkpoint", "positive", "negative", "steps", "cfg", "sampler", "scheduler"} {
+		metadata[key] = req.Params[key]
+	}
+	payload, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = artifacts.PutBytes(ctx, s.store, req.StageId+"/metadata.json", payload, "application/json")
+	return err
+}
+
 func (s *stageServer) Health(ctx context.Context, req *orchestratorv1.HealthRequest) (*orchestratorv1.HealthResponse, error) {
 	return &orchestratorv1.HealthResponse{Status: "ok"}, nil
 }
@@ -119,3 +292,12 @@ func envOrDefault(key, fallback string) string {
 	}
 	return fallback
 }
+
+func envDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,90 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// DigestPrefix marks digests as SHA-256 in TensorRef.digest and ArtifactRef.digest.
+const DigestPrefix = "sha256:"
+
+// ErrDigestMismatch is returned when stored bytes no longer match their recorded digest.
+var ErrDigestMismatch = errors.New("artifact digest mismatch")
+
+// Digest returns the sha256:<hex> digest of data.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return DigestPrefix + hex.EncodeToString(sum[:])
+}
+
+// DigestReader hashes r to EOF and returns its digest and length.
+func DigestReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", n, err
+	}
+	return formatDigest(h), n, nil
+}
+
+// ETag renders a digest as a strong HTTP entity tag.
+func ETag(digest string) string {
+	return `"` + strings.TrimPrefix(digest, DigestPrefix) + `"`
+}
+
+// Verify re-reads key and checks it against want. An empty want only checks
+// that the artifact exists.
+func Verify(ctx context.Context, store Store, key, want string) (Object, error) {
+	body, obj, err := store.Get(ctx, key)
+	if err != nil {
+		return Object{}, err
+	}
+	defer body.Close()
+	if want == "" {
+		return obj, nil
+	}
+	if !strings.HasPrefix(want, DigestPrefix) {
+		return Object{}, fmt.Errorf("artifacts: unsupported digest %q", want)
+	}
+	got, size, err := DigestReader(body)
+	if err != nil {
+		return Object{}, err
+	}
+	if got != want {
+		return Object{}, fmt.Errorf("%w: %s has %s, want %s", ErrDigestMismatch, key, got, want)
+	}
+	obj.Digest = got
+	obj.Size = size
+	return obj, nil
+}
+
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, h: sha256.New()}
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *hashingReader) digest() string {
+	return formatDigest(r.h)
+}
+
+func formatDigest(h hash.Hash) string {
+	return DigestPrefix + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,334 @@
+package artifacts
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"comfy-service-tests/internal/metrics"
+)
+
+// digestCacheSize bounds how many digests a FileStore keeps in memory. The
+// least recently used are evicted and re-hashed if they are needed again.
+const digestCacheSize = 4096
+
+var (
+	digestCacheLookups   = metrics.Default.NewCounter("comfy_artifact_digest_cache_lookups_total", "FileStore digest lookups, by result (hit or miss).", "result")
+	digestCacheEvictions = metrics.Default.NewCounter("comfy_artifact_digest_cache_evictions_total", "FileStore digests evicted to stay within the cache size.")
+)
+
+// FileStore keeps artifacts in a local (or shared volume) directory. Digests
+// are cached per path and recomputed when the file's size or mtime changes.
+type FileStore struct {
+	root string
+
+	mu      sync.Mutex
+	digests *digestCache
+}
+
+type cachedDigest struct {
+	size    int64
+	modTime time.Time
+	digest  string
+}
+
+// digestCache is a fixed-size LRU of digests keyed by path; callers hold
+// FileStore.mu.
+type digestCache struct {
+	limit   int
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+}
+
+type digestEntry struct {
+	path string
+	cachedDigest
+}
+
+func newDigestCache(limit int) *digestCache {
+	return &digestCache{limit: limit, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *digestCache) get(path string) (cachedDigest, bool) {
+	elem, ok := c.entries[path]
+	if !ok {
+		return cachedDigest{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*digestEntry).cachedDigest, true
+}
+
+func (c *digestCache) put(path string, digest cachedDigest) {
+	if elem, ok := c.entries[path]; ok {
+		elem.Value.(*digestEntry).cachedDigest = digest
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[path] = c.order.PushFront(&digestEntry{path: path, cachedDigest: digest})
+	for c.order.Len() > c.limit {
+		c.remove(c.order.Back().Value.(*digestEntry).path)
+		digestCacheEvictions.Inc()
+	}
+}
+
+func (c *digestCache) remove(path string) {
+	if elem, ok := c.entries[path]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, path)
+	}
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if root == "" {
+		return nil, errors.New("artifacts: empty file store root")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{root: abs, digests: newDigestCache(digestCacheSize)}, nil
+}
+
+// Root returns the directory backing the store.
+func (s *FileStore) Root() string {
+	return s.root
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	target, err := SafeJoin(s.root, key)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	return target, nil
+}
+
+// Put writes body to a temporary file and renames it into place, so readers
+// never observe a partially written artifact.
+func (s *FileStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return Object{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return Object{}, err
+	}
+	hashed := newHashingReader(body)
+	_, copyErr := io.Copy(tmp, hashed)
+	closeErr := tmp.Close()
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr == nil {
+		copyErr = os.Chmod(tmp.Name(), 0o644)
+	}
+	if copyErr == nil {
+		copyErr = os.Rename(tmp.Name(), target)
+	}
+	if copyErr != nil {
+		os.Remove(tmp.Name())
+		return Object{}, copyErr
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return Object{}, err
+	}
+	s.mu.Lock()
+	s.digests.put(target, cachedDigest{size: info.Size(), modTime: info.ModTime(), digest: hashed.digest()})
+	s.mu.Unlock()
+	return s.object(key, target, info)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, Object{}, notFound(key, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Object{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, Object{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	obj, err := s.object(key, target, info)
+	if err != nil {
+		file.Close()
+		return nil, Object{}, err
+	}
+	return file, obj, nil
+}
+
+func (s *FileStore) Stat(ctx context.Context, key string) (Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return Object{}, notFound(key, err)
+	}
+	if info.IsDir() {
+		return Object{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return s.object(key, target, info)
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.digests.remove(target)
+	s.mu.Unlock()
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks only the directory that holds prefix. Like S3Store.List it
+// leaves Digest and ETag empty; Stat hashes a single object when needed.
+func (s *FileStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	start := s.root
+	if dir := path.Dir(prefix); dir != "." {
+		var err error
+		if start, err = SafeJoin(s.root, dir); err != nil {
+			return nil, err
+		}
+	}
+	var objects []Object
+	err := filepath.WalkDir(start, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, current)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{
+			Key:         key,
+			Size:        info.Size(),
+			ContentType: contentTypeFor(key),
+			ModTime:     info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *FileStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", fmt.Errorf("artifacts: file store cannot sign urls: %w", errors.ErrUnsupported)
+}
+
+func (s *FileStore) URI(key string) string {
+	return "file://" + filepath.ToSlash(filepath.Join(s.root, filepath.FromSlash(key)))
+}
+
+func (s *FileStore) keyFor(uri string) (string, bool) {
+	p := strings.TrimPrefix(uri, "file://")
+	if !filepath.IsAbs(p) {
+		return "", false
+	}
+	rel, err := filepath.Rel(s.root, filepath.Clean(p))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (s *FileStore) object(key, target string, info fs.FileInfo) (Object, error) {
+	digest, err := s.digest(target, info)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: contentTypeFor(key),
+		Digest:      digest,
+		ETag:        ETag(digest),
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+func (s *FileStore) digest(target string, info fs.FileInfo) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.digests.get(target)
+	s.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		digestCacheLookups.Inc("hit")
+		return cached.digest, nil
+	}
+	digestCacheLookups.Inc("miss")
+
+	file, err := os.Open(target)
+	if err != nil {
+		return "", notFound(filepath.Base(target), err)
+	}
+	defer file.Close()
+	digest, _, err := DigestReader(file)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.digests.put(target, cachedDigest{size: info.Size(), modTime: info.ModTime(), digest: digest})
+	s.mu.Unlock()
+	return digest, nil
+}
+
+func contentTypeFor(key string) string {
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+func notFound(key string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
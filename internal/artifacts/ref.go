@@ -0,0 +1,154 @@
+package artifacts
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+)
+
+// RefScheme is the store-independent scheme used in TensorRef.uri:
+// artifact://<job-id>/<name> names <name> inside the job's artifact directory.
+const RefScheme = "artifact"
+
+var (
+	// ErrInvalidRef is returned for refs with unparseable URIs or bad metadata.
+	ErrInvalidRef = errors.New("invalid tensor ref")
+	// ErrOutsideRoot is returned for file:// or s3:// URIs that do not belong to a configured store.
+	ErrOutsideRoot = errors.New("artifact uri outside store root")
+)
+
+// RefURI returns the artifact:// URI for key, whose first segment is the job id.
+func RefURI(key string) string {
+	return RefScheme + "://" + key
+}
+
+// Resolver maps TensorRef URIs to a store and key. artifact:// URIs resolve
+// against the primary store; file:// and s3:// URIs (and bare paths written
+// by older stage services) must fall inside one of the configured stores.
+type Resolver struct {
+	stores []Store
+}
+
+func NewResolver(primary Store, others ...Store) *Resolver {
+	return &Resolver{stores: append([]Store{primary}, others...)}
+}
+
+// Resolve returns the store holding uri and the key within it.
+func (r *Resolver) Resolve(uri string) (Store, string, error) {
+	if uri == "" {
+		return nil, "", fmt.Errorf("%w: empty uri", ErrInvalidRef)
+	}
+	if !strings.Contains(uri, "://") {
+		if !strings.HasPrefix(uri, "/") {
+			return nil, "", fmt.Errorf("%w: relative path %q", ErrInvalidRef, uri)
+		}
+		return r.match("file://" + uri)
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidRef, err)
+	}
+	switch parsed.Scheme {
+	case RefScheme:
+		if parsed.User != nil || parsed.Port() != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+			return nil, "", fmt.Errorf("%w: %q", ErrInvalidRef, uri)
+		}
+		key := parsed.Host + parsed.Path
+		if err := validateKey(key); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidRef, err)
+		}
+		if !strings.Contains(key, "/") {
+			return nil, "", fmt.Errorf("%w: %q has no artifact name", ErrInvalidRef, uri)
+		}
+		return r.stores[0], key, nil
+	case "file", "s3":
+		return r.match(uri)
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported scheme %q", ErrInvalidRef, parsed.Scheme)
+	}
+}
+
+func (r *Resolver) match(uri string) (Store, string, error) {
+	for _, store := range r.stores {
+		resolver, ok := store.(interface{ keyFor(string) (string, bool) })
+		if !ok {
+			continue
+		}
+		key, ok := resolver.keyFor(uri)
+		if !ok {
+			continue
+		}
+		if err := validateKey(key); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrOutsideRoot, err)
+		}
+		return store, key, nil
+	}
+	return nil, "", fmt.Errorf("%w: %s", ErrOutsideRoot, uri)
+}
+
+// ResolveRef validates ref's metadata and resolves its URI.
+func (r *Resolver) ResolveRef(ref *orchestratorv1.TensorRef) (Store, string, error) {
+	if err := ValidateRef(ref); err != nil {
+		return nil, "", err
+	}
+	return r.Resolve(ref.GetUri())
+}
+
+// Image outputs use a MIME dtype; tensors use numpy-style element types.
+var knownDtypes = map[string]bool{
+	"image/png": true, "image/jpeg": true, "image/webp": true,
+	"float16": true, "bfloat16": true, "float32": true, "float64": true,
+	"int8": true, "int16": true, "int32": true, "int64": true, "uint8": true, "bool": true,
+}
+
+const maxRank = 8
+
+// ValidateRef checks shape, dtype, device and digest metadata without touching storage.
+func ValidateRef(ref *orchestratorv1.TensorRef) error {
+	if ref == nil {
+		return fmt.Errorf("%w: nil ref", ErrInvalidRef)
+	}
+	if len(ref.Shape) > maxRank {
+		return fmt.Errorf("%w: rank %d exceeds %d", ErrInvalidRef, len(ref.Shape), maxRank)
+	}
+	for i, dim := range ref.Shape {
+		if dim <= 0 {
+			return fmt.Errorf("%w: shape[%d] = %d", ErrInvalidRef, i, dim)
+		}
+	}
+	if ref.Dtype != "" && !knownDtypes[ref.Dtype] {
+		return fmt.Errorf("%w: unknown dtype %q", ErrInvalidRef, ref.Dtype)
+	}
+	if strings.HasPrefix(ref.Dtype, "image/") && len(ref.Shape) > 0 {
+		if len(ref.Shape) != 3 || (ref.Shape[2] != 1 && ref.Shape[2] != 3 && ref.Shape[2] != 4) {
+			return fmt.Errorf("%w: image shape %v is not [height width channels]", ErrInvalidRef, ref.Shape)
+		}
+	}
+	if !validDevice(ref.Device) {
+		return fmt.Errorf("%w: unknown device %q", ErrInvalidRef, ref.Device)
+	}
+	if ref.Digest != "" && (!strings.HasPrefix(ref.Digest, DigestPrefix) || len(ref.Digest) != len(DigestPrefix)+64) {
+		return fmt.Errorf("%w: malformed digest %q", ErrInvalidRef, ref.Digest)
+	}
+	if ref.SizeBytes < 0 {
+		return fmt.Errorf("%w: negative size", ErrInvalidRef)
+	}
+	return nil
+}
+
+func validDevice(device string) bool {
+	switch device {
+	case "", "cpu", "cuda", "mps":
+		return true
+	}
+	if index, ok := strings.CutPrefix(device, "cuda:"); ok {
+		n, err := strconv.Atoi(index)
+		return err == nil && n >= 0
+	}
+	return false
+}
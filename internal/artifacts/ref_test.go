@@ -0,0 +1,80 @@
+package artifacts
+
+import (
+	"errors"
+	"testing"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+)
+
+func TestResolverMapsSchemes(t *testing.T) {
+	local, err := NewFileStore("/artifacts")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	bucket, err := NewS3Store(S3Config{Endpoint: "http://minio:9000", Bucket: "outputs", Prefix: "jobs", PathStyle: true})
+	if err != nil {
+		t.Fatalf("open s3: %v", err)
+	}
+	resolver := NewResolver(local, bucket)
+
+	for uri, want := range map[string]struct {
+		store Store
+		key   string
+	}{
+		"artifact://wf-1/output.png":        {local, "wf-1/output.png"},
+		"file:///artifacts/wf-1/output.png": {local, "wf-1/output.png"},
+		"/artifacts/wf-1/output.png":        {local, "wf-1/output.png"},
+		"s3://outputs/jobs/wf-1/output.png": {bucket, "wf-1/output.png"},
+	} {
+		store, key, err := resolver.Resolve(uri)
+		if err != nil || store != want.store || key != want.key {
+			t.Fatalf("Resolve(%q) = %v, %q, %v; want %q", uri, store, key, err, want.key)
+		}
+	}
+}
+
+func TestResolverRejectsEscapes(t *testing.T) {
+	local, err := NewFileStore("/artifacts")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	resolver := NewResolver(local)
+
+	cases := map[string]error{
+		"artifact://../etc/passwd":        ErrInvalidRef,
+		"artifact://wf-1/%2e%2e/x":        ErrInvalidRef,
+		"artifact://wf-1":                 ErrInvalidRef,
+		"artifact://wf-1/a?b=c":           ErrInvalidRef,
+		"file:///artifacts/../etc/passwd": ErrOutsideRoot,
+		"/etc/passwd":                     ErrOutsideRoot,
+		"s3://other-bucket/wf-1/out.png":  ErrOutsideRoot,
+		"relative/output.png":             ErrInvalidRef,
+		"http://example.com/output.png":   ErrInvalidRef,
+	}
+	for uri, want := range cases {
+		if _, _, err := resolver.Resolve(uri); !errors.Is(err, want) {
+			t.Fatalf("Resolve(%q) error = %v, want %v", uri, err, want)
+		}
+	}
+}
+
+func TestValidateRef(t *testing.T) {
+	valid := &orchestratorv1.TensorRef{Uri: "artifact://wf-1/output.png", Shape: []int64{512, 512, 3}, Dtype: "image/png", Device: "cuda:0"}
+	if err := ValidateRef(valid); err != nil {
+		t.Fatalf("expected valid ref: %v", err)
+	}
+	for name, ref := range map[string]*orchestratorv1.TensorRef{
+		"zero dim":     {Shape: []int64{0, 512, 3}},
+		"dtype":        {Dtype: "complex512"},
+		"image shape":  {Shape: []int64{512, 512}, Dtype: "image/png"},
+		"device":       {Device: "tpu"},
+		"cuda index":   {Device: "cuda:-1"},
+		"digest":       {Digest: "md5:abc"},
+		"negative len": {SizeBytes: -1},
+	} {
+		if err := ValidateRef(ref); !errors.Is(err, ErrInvalidRef) {
+			t.Fatalf("%s: expected ErrInvalidRef, got %v", name, err)
+		}
+	}
+}
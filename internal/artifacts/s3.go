@@ -0,0 +1,356 @@
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config describes an S3-compatible bucket. Endpoint may point at MinIO or
+// another compatible service; PathStyle addresses objects as
+// <endpoint>/<bucket>/<key> instead of <bucket>.<endpoint>/<key>.
+type S3Config struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	PathStyle    bool
+	HTTPClient   *http.Client
+}
+
+// digestMetaHeader stores the SHA-256 digest as user metadata, since S3 ETags
+// are MD5 (or multipart composites) and cannot be verified directly.
+const digestMetaHeader = "X-Amz-Meta-Sha256"
+
+// S3Store stores artifacts in an S3-compatible bucket using SigV4-signed REST calls.
+type S3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	pathStyle bool
+	signer    signer
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("artifacts: s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("artifacts: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Store{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		prefix:    prefix,
+		pathStyle: cfg.PathStyle,
+		signer: signer{
+			creds:   credentials{AccessKey: cfg.AccessKey, SecretKey: cfg.SecretKey, SessionToken: cfg.SessionToken},
+			region:  cfg.Region,
+			service: "s3",
+		},
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+// newS3StoreFromURL handles s3://bucket/prefix?endpoint=...&region=...&path_style=true.
+func newS3StoreFromURL(u *url.URL) (*S3Store, error) {
+	query := u.Query()
+	cfg := S3Config{
+		Bucket:       u.Host,
+		Prefix:       u.Path,
+		Endpoint:     query.Get("endpoint"),
+		Region:       query.Get("region"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = os.Getenv("S3_ENDPOINT")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	// Custom endpoints (MinIO, Ceph, ...) rarely support virtual-hosted buckets.
+	cfg.PathStyle = cfg.Endpoint != ""
+	if value := query.Get("path_style"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("artifacts: invalid path_style %q", value)
+		}
+		cfg.PathStyle = parsed
+	}
+	return NewS3Store(cfg)
+}
+
+func (s *S3Store) objectKey(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return s.prefix + key, nil
+}
+
+func (s *S3Store) objectURL(objectKey string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + objectKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + objectKey
+	}
+	u.RawPath = ""
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (s *S3Store) do(ctx context.Context, method string, u *url.URL, body []byte, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	payloadHash := emptyPayloadSHA
+	if body != nil {
+		reader = bytes.NewReader(body)
+		payloadHash = hashHex(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.signer.sign(req, payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+// Put buffers body so the payload hash can be signed; artifacts are single
+// rendered outputs, not multi-gigabyte uploads.
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) (Object, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return Object{}, err
+	}
+	if contentType == "" {
+		contentType = contentTypeFor(key)
+	}
+	digest := Digest(payload)
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set(digestMetaHeader, digest)
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(objectKey, nil), payload, header)
+	if err != nil {
+		return Object{}, err
+	}
+	defer drain(resp)
+	if err := s3Error(resp, key); err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:         key,
+		Size:        int64(len(payload)),
+		ContentType: contentType,
+		Digest:      digest,
+		ETag:        ETag(digest),
+		ModTime:     s.now(),
+	}, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(objectKey, nil), nil, nil)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	if err := s3Error(resp, key); err != nil {
+		drain(resp)
+		return nil, Object{}, err
+	}
+	return resp.Body, headerObject(key, resp), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (Object, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(objectKey, nil), nil, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	defer drain(resp)
+	if err := s3Error(resp, key); err != nil {
+		return Object{}, err
+	}
+	return headerObject(key, resp), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(objectKey, nil), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer drain(resp)
+	if err := s3Error(resp, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2 until the listing is complete.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := s.objectURL("", query)
+		resp, err := s.do(ctx, http.MethodGet, u, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := s3Error(resp, prefix); err != nil {
+			drain(resp)
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		drain(resp)
+		if err != nil {
+			return nil, fmt.Errorf("artifacts: decode list response: %w", err)
+		}
+		for _, item := range result.Contents {
+			key := strings.TrimPrefix(item.Key, s.prefix)
+			objects = append(objects, Object{
+				Key:         key,
+				Size:        item.Size,
+				ContentType: contentTypeFor(key),
+				ETag:        item.ETag,
+				ModTime:     item.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// SignedURL returns a presigned GET URL; S3 caps expiry at seven days.
+func (s *S3Store) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return "", err
+	}
+	if expiry <= 0 || expiry > 7*24*time.Hour {
+		return "", fmt.Errorf("artifacts: signed url expiry %s out of range", expiry)
+	}
+	return s.signer.presign(http.MethodGet, s.objectURL(objectKey, nil), expiry, s.now()).String(), nil
+}
+
+func (s *S3Store) keyFor(uri string) (string, bool) {
+	prefix := "s3://" + s.bucket + "/" + s.prefix
+	if !strings.HasPrefix(uri, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, prefix), true
+}
+
+func (s *S3Store) URI(key string) string {
+	return "s3://" + s.bucket + "/" + s.prefix + key
+}
+
+func headerObject(key string, resp *http.Response) Object {
+	obj := Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if digest := resp.Header.Get(digestMetaHeader); strings.HasPrefix(digest, DigestPrefix) {
+		obj.Digest = digest
+		obj.ETag = ETag(digest)
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = modified
+	}
+	return obj
+}
+
+type s3ErrorBody struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3Error(resp *http.Response, key string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	var body s3ErrorBody
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("artifacts: s3 %s %s: %s", resp.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("artifacts: s3 returned %s", resp.Status)
+}
+
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,97 @@
+package artifacts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath is returned when a joined path would leave its root.
+var ErrUnsafePath = errors.New("unsafe artifact path")
+
+// SafeJoin joins slash-separated elems onto root and guarantees the result
+// stays inside root. It rejects absolute elements, '..' segments, backslashes
+// and NUL bytes, and resolves symlinks in the existing part of the path so a
+// link inside root cannot redirect reads or writes elsewhere. The returned
+// path is the lexical join; it is safe to create if it does not exist yet.
+func SafeJoin(root string, elems ...string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("%w: empty root", ErrUnsafePath)
+	}
+	for _, elem := range elems {
+		if err := checkElem(elem); err != nil {
+			return "", err
+		}
+	}
+
+	cleanRoot := filepath.Clean(root)
+	joined := filepath.Join(append([]string{cleanRoot}, filepathElems(elems)...)...)
+	if !within(cleanRoot, joined) {
+		return "", fmt.Errorf("%w: %s escapes %s", ErrUnsafePath, joined, cleanRoot)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(cleanRoot)
+	if errors.Is(err, fs.ErrNotExist) {
+		return joined, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	existing, rest := deepestExisting(joined, cleanRoot)
+	realExisting, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, filepath.Join(realExisting, rest)) {
+		return "", fmt.Errorf("%w: %s resolves outside %s", ErrUnsafePath, joined, cleanRoot)
+	}
+	return joined, nil
+}
+
+func checkElem(elem string) error {
+	if elem == "" {
+		return fmt.Errorf("%w: empty path element", ErrUnsafePath)
+	}
+	if strings.ContainsAny(elem, "\\\x00") || strings.HasPrefix(elem, "/") || filepath.IsAbs(elem) {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, elem)
+	}
+	for _, segment := range strings.Split(elem, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q", ErrUnsafePath, elem)
+		}
+	}
+	return nil
+}
+
+func filepathElems(elems []string) []string {
+	out := make([]string, len(elems))
+	for i, elem := range elems {
+		out[i] = filepath.FromSlash(elem)
+	}
+	return out
+}
+
+// deepestExisting walks up from p until it finds a path that exists (at worst
+// root itself) and returns it with the not-yet-created remainder.
+func deepestExisting(p, root string) (string, string) {
+	rest := ""
+	for p != root {
+		if _, err := os.Lstat(p); err == nil {
+			return p, rest
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = filepath.Dir(p)
+	}
+	return root, rest
+}
+
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,79 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoinRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	for _, elems := range [][]string{
+		{"../etc"},
+		{"wf-1", "../../etc/passwd"},
+		{"wf-1/../../x"},
+		{"/etc/passwd"},
+		{`..\..\windows`},
+		{"wf-1", ""},
+		{"wf-1/./output.png"},
+		{"wf-1\x00.png"},
+	} {
+		if _, err := SafeJoin(root, elems...); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("SafeJoin(%q) error = %v, want ErrUnsafePath", elems, err)
+		}
+	}
+
+	got, err := SafeJoin(root, "wf-1", "output.png")
+	if err != nil || got != filepath.Join(root, "wf-1", "output.png") {
+		t.Fatalf("unexpected join %q, err %v", got, err)
+	}
+}
+
+// Percent-encoded separators are not decoded by SafeJoin; they stay literal
+// characters in a single segment and cannot climb out of root.
+func TestSafeJoinKeepsEncodedSlashesLiteral(t *testing.T) {
+	root := t.TempDir()
+	got, err := SafeJoin(root, "..%2F..%2Fetc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filepath.Dir(got) != filepath.Clean(root) {
+		t.Fatalf("encoded slashes produced nested path %q", got)
+	}
+}
+
+func TestSafeJoinRejectsSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "wf-evil")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, elems := range [][]string{{"wf-evil", "secret"}, {"wf-evil", "new", "output.png"}, {"wf-evil"}} {
+		if _, err := SafeJoin(root, elems...); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("SafeJoin(%q) error = %v, want ErrUnsafePath", elems, err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(root, "wf-1"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "wf-1"), filepath.Join(root, "wf-alias")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if _, err := SafeJoin(root, "wf-alias", "output.png"); err != nil {
+		t.Fatalf("symlink within root should be allowed: %v", err)
+	}
+
+	store, err := NewFileStore(root)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := store.Stat(context.Background(), "wf-evil/secret"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected store to reject symlink escape, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an artifact key does not exist.
+var ErrNotFound = errors.New("artifact not found")
+
+// ErrInvalidKey is returned for empty, absolute or parent-relative keys.
+var ErrInvalidKey = errors.New("invalid artifact key")
+
+// Object describes a stored artifact.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	// Digest is the sha256:<hex> content digest; ETag is derived from it when known.
+	Digest  string
+	ETag    string
+	ModTime time.Time
+}
+
+// Store is the artifact IO boundary shared by the gateway and stage services.
+// Keys are slash-separated paths relative to the store root, e.g. "<job-id>/output.png".
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (Object, error)
+	// Get returns the artifact body; callers must close it. Local bodies also
+	// implement io.ReadSeeker so they can be served with range support.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+	// List returns objects whose key starts with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// SignedURL returns a time-limited URL clients can fetch directly. Stores
+	// without a public endpoint return an error wrapping errors.ErrUnsupported.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// URI returns the canonical file:// or s3:// location of key.
+	URI(key string) string
+}
+
+// Open builds a store from a URI:
+//
+//	file:///artifacts                          local directory
+//	/artifacts                                 same as file://
+//	s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1
+//
+// S3 credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN; S3_ENDPOINT and AWS_REGION fill in missing query values.
+func Open(uri string) (Store, error) {
+	if uri == "" {
+		return nil, errors.New("artifacts: empty store uri")
+	}
+	if !strings.Contains(uri, "://") {
+		return NewFileStore(uri)
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("artifacts: parse %q: %w", uri, err)
+	}
+	switch parsed.Scheme {
+	case "file":
+		return NewFileStore(parsed.Path)
+	case "s3":
+		return newS3StoreFromURL(parsed)
+	default:
+		return nil, fmt.Errorf("artifacts: unsupported scheme %q", parsed.Scheme)
+	}
+}
+
+// OpenFromEnv opens ARTIFACTS_URI, falling back to a file store at root.
+func OpenFromEnv(root string) (Store, error) {
+	if uri := os.Getenv("ARTIFACTS_URI"); uri != "" {
+		return Open(uri)
+	}
+	return NewFileStore(root)
+}
+
+// PutBytes stores payload under key.
+func PutBytes(ctx context.Context, store Store, key string, payload []byte, contentType string) (Object, error) {
+	return store.Put(ctx, key, bytes.NewReader(payload), contentType)
+}
+
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	store, err := Open("file://" + root)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ctx := context.Background()
+
+	obj, err := PutBytes(ctx, store, "wf-1/output.png", []byte("png-bytes"), "image/png")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if obj.Size != 9 || obj.ContentType != "image/png" || obj.ETag == "" {
+		t.Fatalf("unexpected object %+v", obj)
+	}
+	if _, err := os.Stat(filepath.Join(root, "wf-1", "output.png")); err != nil {
+		t.Fatalf("expected file on disk: %v", err)
+	}
+
+	body, _, err := store.Get(ctx, "wf-1/output.png")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "png-bytes" {
+		t.Fatalf("unexpected body %q", data)
+	}
+	if _, ok := body.(io.ReadSeeker); !ok {
+		t.Fatalf("expected file body to be seekable")
+	}
+
+	if _, err := PutBytes(ctx, store, "wf-2/output.png", []byte("x"), ""); err != nil {
+		t.Fatalf("put second: %v", err)
+	}
+	listed, err := store.List(ctx, "wf-1/")
+	if err != nil || len(listed) != 1 || listed[0].Key != "wf-1/output.png" {
+		t.Fatalf("unexpected listing %+v, err %v", listed, err)
+	}
+	if listed[0].Size != int64(len("png-bytes")) || listed[0].Digest != "" || listed[0].ETag != "" {
+		t.Fatalf("listing should carry size but no digest: %+v", listed[0])
+	}
+	for prefix, want := range map[string]int{"": 2, "wf": 2, "wf-2/out": 1, "wf-3/": 0, "wf-1/output.png/": 0} {
+		if listed, err := store.List(ctx, prefix); err != nil || len(listed) != want {
+			t.Fatalf("List(%q) = %+v, err %v; want %d objects", prefix, listed, err, want)
+		}
+	}
+	if _, err := store.List(ctx, "../wf-1/"); !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("expected a traversing prefix to be rejected, got %v", err)
+	}
+
+	if got := store.URI("wf-1/output.png"); got != "file://"+filepath.ToSlash(root)+"/wf-1/output.png" {
+		t.Fatalf("unexpected uri %q", got)
+	}
+	if _, err := store.SignedURL(ctx, "wf-1/output.png", time.Minute); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected unsupported signed url, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "wf-1/output.png"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, "wf-1/output.png"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestFileStoreDigestCacheIsBounded(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	store.digests = newDigestCache(2)
+	evictions := digestCacheEvictions.Value()
+	ctx := context.Background()
+	for _, key := range []string{"a/out.png", "b/out.png", "c/out.png"} {
+		if _, err := PutBytes(ctx, store, key, []byte(key), "image/png"); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	if got := len(store.digests.entries); got != 2 {
+		t.Fatalf("expected 2 cached digests, got %d", got)
+	}
+	if _, ok := store.digests.get(filepath.Join(store.Root(), "a", "out.png")); ok {
+		t.Fatal("expected the least recently used digest to be evicted")
+	}
+	// Evicted digests are recomputed on demand.
+	misses, hits := digestCacheLookups.Value("miss"), digestCacheLookups.Value("hit")
+	obj, err := store.Stat(ctx, "a/out.png")
+	if err != nil || obj.Digest != Digest([]byte("a/out.png")) {
+		t.Fatalf("stat after eviction: %+v, %v", obj, err)
+	}
+	if _, err := store.Stat(ctx, "a/out.png"); err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if got := digestCacheEvictions.Value() - evictions; got != 2 {
+		t.Fatalf("expected 2 evictions, got %v", got)
+	}
+	if missed, hit := digestCacheLookups.Value("miss")-misses, digestCacheLookups.Value("hit")-hits; missed != 1 || hit != 1 {
+		t.Fatalf("expected 1 miss and 1 hit, got %v and %v", missed, hit)
+	}
+}
+
+func TestStoresRejectInvalidKeys(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../b", `a\b`, "a//b"} {
+		if _, err := store.Stat(context.Background(), key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("key %q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestOpenRejectsUnknownScheme(t *testing.T) {
+	if _, err := Open("gs://bucket"); err == nil || !strings.Contains(err.Error(), "unsupported scheme") {
+		t.Fatalf("expected unsupported scheme error, got %v", err)
+	}
+}
+
+func TestVerifyDetectsCorruption(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFileStore(root)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ctx := context.Background()
+	obj, err := PutBytes(ctx, store, "wf-1/output.png", []byte("abc"), "")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	const want = "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if obj.Digest != want || obj.ETag != `"`+strings.TrimPrefix(want, DigestPrefix)+`"` {
+		t.Fatalf("unexpected digest %q etag %q", obj.Digest, obj.ETag)
+	}
+	if _, err := Verify(ctx, store, "wf-1/output.png", want); err != nil {
+		t.Fatalf("verify intact: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "wf-1", "output.png"), []byte("abd"), 0o644); err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+	if _, err := Verify(ctx, store, "wf-1/output.png", want); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Package auth authenticates gateway callers with static API keys or
+// HMAC-signed bearer tokens and checks the scopes they were granted.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scope is a permission granted to a key or token.
+type Scope string
+
+const (
+	// ScopeSubmit allows submitting workflows.
+	ScopeSubmit Scope = "submit"
+	// ScopeRead allows reading jobs, events, outputs and catalogs.
+	ScopeRead Scope = "read"
+	// ScopeAdmin allows everything, including metrics and minting tokens for
+	// other subjects.
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope validates a scope name.
+func ParseScope(name string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(strings.TrimSpace(name))); scope {
+	case ScopeSubmit, ScopeRead, ScopeAdmin:
+		return scope, nil
+	}
+	return "", fmt.Errorf("auth: unknown scope %q", name)
+}
+
+// Method values for Identity.Method.
+const (
+	MethodAPIKey = "api_key"
+	MethodToken  = "token"
+)
+
+var (
+	// ErrNoCredentials is returned when a request carries no key or token.
+	ErrNoCredentials = errors.New("auth: no credentials")
+	// ErrInvalidCredentials is returned for unknown keys and bad tokens.
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+	// ErrTokenExpired is returned for correctly signed tokens past their expiry.
+	ErrTokenExpired = errors.New("auth: token expired")
+)
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Subject string
+	Scopes  []Scope
+	Method  string
+	// ExpiresAt is set for tokens.
+	ExpiresAt time.Time
+	// MaxActiveJobs overrides the gateway's per-caller job quota when positive.
+	MaxActiveJobs int
+}
+
+// Allows reports whether the identity holds scope; admin holds every scope.
+func (id Identity) Allows(scope Scope) bool {
+	for _, granted := range id.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored by WithIdentity.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Authenticator verifies API keys and bearer tokens. An Authenticator with
+// neither is disabled, and Middleware then admits every request.
+type Authenticator struct {
+	keys   map[[sha256.Size]byte]Identity
+	secret []byte
+	now    func() time.Time
+}
+
+// New builds an authenticator from API keys and a token signing secret.
+// Either may be empty; tokens are rejected when secret is.
+func New(keys []Key, secret []byte) *Authenticator {
+	a := &Authenticator{
+		keys:   make(map[[sha256.Size]byte]Identity, len(keys)),
+		secret: append([]byte(nil), secret...),
+		now:    time.Now,
+	}
+	for _, key := range keys {
+		a.keys[key.digest] = Identity{Subject: key.Name, Scopes: key.Scopes, Method: MethodAPIKey, MaxActiveJobs: key.MaxActiveJobs}
+	}
+	return a
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *Authenticator) Enabled() bool {
+	return a != nil && (len(a.keys) > 0 || len(a.secret) > 0)
+}
+
+// TokensEnabled reports whether a signing secret is configured.
+func (a *Authenticator) TokensEnabled() bool {
+	return a != nil && len(a.secret) > 0
+}
+
+// Authenticate checks a credential, which is either an API key or a token
+// issued by IssueToken.
+func (a *Authenticator) Authenticate(credential string) (Identity, error) {
+	if credential == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	if !a.Enabled() {
+		return Identity{}, ErrInvalidCredentials
+	}
+	if id, ok := a.keys[sha256.Sum256([]byte(credential))]; ok {
+		return id, nil
+	}
+	if strings.HasPrefix(credential, tokenPrefix) && a.TokensEnabled() {
+		return a.verifyToken(credential)
+	}
+	return Identity{}, ErrInvalidCredentials
+}
+
+// Credential returns the key or token a request carries: an
+// "Authorization: Bearer" header, then X-API-Key. Browsers cannot set headers
+// on WebSocket handshakes, so upgrade requests may pass ?access_token= instead.
+func Credential(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, value, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(value)
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
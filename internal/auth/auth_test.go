@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	ciKey  = "ci-key-0123456789abcdef"
+	opsKey = "ops-key-0123456789abcdef"
+)
+
+var testSecret = []byte(strings.Repeat("s", MinSecretLength))
+
+func testKeys(t *testing.T) []Key {
+	t.Helper()
+	digest := sha256.Sum256([]byte(opsKey))
+	keys, err := ParseKeys([]byte(`{"keys": [
+		{"name": "ci", "key": "` + ciKey + `", "scopes": ["submit", "read"]},
+		{"name": "ops", "key_sha256": "` + hex.EncodeToString(digest[:]) + `", "scopes": ["admin"], "max_active_jobs": 50}
+	]}`))
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	return keys
+}
+
+func TestParseKeysRejectsBadEntries(t *testing.T) {
+	for name, doc := range map[string]string{
+		"missing name":   `{"keys": [{"key": "0123456789abcdef", "scopes": ["read"]}]}`,
+		"short key":      `{"keys": [{"name": "a", "key": "short", "scopes": ["read"]}]}`,
+		"bad digest":     `{"keys": [{"name": "a", "key_sha256": "abc", "scopes": ["read"]}]}`,
+		"unknown scope":  `{"keys": [{"name": "a", "key": "0123456789abcdef", "scopes": ["write"]}]}`,
+		"no scopes":      `{"keys": [{"name": "a", "key": "0123456789abcdef"}]}`,
+		"duplicate name": `{"keys": [{"name": "a", "key": "0123456789abcdef", "scopes": ["read"]}, {"name": "a", "key": "fedcba9876543210", "scopes": ["read"]}]}`,
+		"duplicate key":  `{"keys": [{"name": "a", "key": "0123456789abcdef", "scopes": ["read"]}, {"name": "b", "key": "0123456789abcdef", "scopes": ["read"]}]}`,
+		"empty":          `{"keys": []}`,
+		"negative quota": `{"keys": [{"name": "a", "key": "0123456789abcdef", "scopes": ["read"], "max_active_jobs": -1}]}`,
+	} {
+		if _, err := ParseKeys([]byte(doc)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAuthenticateAPIKeys(t *testing.T) {
+	a := New(testKeys(t), nil)
+
+	id, err := a.Authenticate(ciKey)
+	if err != nil {
+		t.Fatalf("authenticate ci: %v", err)
+	}
+	if id.Subject != "ci" || id.Method != MethodAPIKey || !id.Allows(ScopeSubmit) || id.Allows(ScopeAdmin) {
+		t.Fatalf("unexpected ci identity %+v", id)
+	}
+	id, err = a.Authenticate(opsKey)
+	if err != nil || !id.Allows(ScopeRead) || !id.Allows(ScopeSubmit) || id.MaxActiveJobs != 50 {
+		t.Fatalf("expected admin key to hold every scope, got %+v, %v", id, err)
+	}
+	if _, err := a.Authenticate("nope-0123456789abcdef"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	if _, err := a.Authenticate(""); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected no credentials, got %v", err)
+	}
+}
+
+func TestTokenRoundTripAndExpiry(t *testing.T) {
+	a := New(nil, testSecret)
+	now := time.Unix(1_700_000_000, 0)
+	a.now = func() time.Time { return now }
+
+	token, expires, err := a.IssueToken(Identity{Subject: "alice", Scopes: []Scope{ScopeRead}}, time.Hour)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry %v", expires)
+	}
+	id, err := a.Authenticate(token)
+	if err != nil {
+		t.Fatalf("authenticate token: %v", err)
+	}
+	if id.Subject != "alice" || id.Method != MethodToken || !id.Allows(ScopeRead) || id.Allows(ScopeSubmit) {
+		t.Fatalf("unexpected token identity %+v", id)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := a.Authenticate(token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected expired token, got %v", err)
+	}
+}
+
+func TestTokenCarriesKeyJobQuota(t *testing.T) {
+	a := New(testKeys(t), testSecret)
+	key, err := a.Authenticate(opsKey)
+	if err != nil {
+		t.Fatalf("authenticate ops: %v", err)
+	}
+	token, _, err := a.IssueToken(key, time.Hour)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	id, err := a.Authenticate(token)
+	if err != nil || id.MaxActiveJobs != 50 {
+		t.Fatalf("expected the token to keep the key's quota, got %+v, %v", id, err)
+	}
+}
+
+func TestTokenRejectsTamperingAndOtherSecrets(t *testing.T) {
+	a := New(nil, testSecret)
+	token, _, err := a.IssueToken(Identity{Subject: "alice", Scopes: []Scope{ScopeRead}}, time.Hour)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	forged, _, err := New(nil, []byte(strings.Repeat("x", MinSecretLength))).IssueToken(Identity{Subject: "alice", Scopes: []Scope{ScopeAdmin}}, time.Hour)
+	if err != nil {
+		t.Fatalf("issue forged: %v", err)
+	}
+	body, sig, _ := strings.Cut(strings.TrimPrefix(token, tokenPrefix), ".")
+	forgedBody, _, _ := strings.Cut(strings.TrimPrefix(forged, tokenPrefix), ".")
+	for _, candidate := range []string{
+		forged,
+		tokenPrefix + forgedBody + "." + sig,
+		tokenPrefix + body + "x." + sig,
+		tokenPrefix + body,
+	} {
+		if _, err := a.Authenticate(candidate); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected %q to be rejected, got %v", candidate, err)
+		}
+	}
+
+	if _, _, err := New(testKeys(t), nil).IssueToken(Identity{Subject: "alice", Scopes: []Scope{ScopeRead}}, time.Hour); err == nil {
+		t.Fatal("expected issuing without a secret to fail")
+	}
+}
+
+func TestMiddlewareEnforcesScopes(t *testing.T) {
+	a := New(testKeys(t), testSecret)
+	var seen Identity
+	handler := Middleware(a, func(r *http.Request) (Scope, bool) {
+		switch r.URL.Path {
+		case "/public":
+			return "", false
+		case "/submit":
+			return ScopeSubmit, true
+		}
+		return ScopeRead, true
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	}))
+
+	token, _, err := a.IssueToken(Identity{Subject: "viewer", Scopes: []Scope{ScopeRead}}, time.Hour)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	for _, tc := range []struct {
+		path    string
+		header  string
+		value   string
+		status  int
+		subject string
+	}{
+		{path: "/public", status: http.StatusOK},
+		{path: "/read", status: http.StatusUnauthorized},
+		{path: "/read", header: "X-API-Key", value: ciKey, status: http.StatusOK, subject: "ci"},
+		{path: "/submit", header: "Authorization", value: "Bearer " + token, status: http.StatusForbidden},
+		{path: "/read", header: "Authorization", value: "bearer " + token, status: http.StatusOK, subject: "viewer"},
+		{path: "/submit", header: "Authorization", value: "Bearer " + opsKey, status: http.StatusOK, subject: "ops"},
+	} {
+		seen = Identity{}
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status || seen.Subject != tc.subject {
+			t.Fatalf("%s with %s: got %d for %q, want %d for %q", tc.path, tc.header, rec.Code, seen.Subject, tc.status, tc.subject)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("expected WWW-Authenticate on 401")
+		}
+	}
+}
+
+func TestCredentialAcceptsAccessTokenOnlyForWebSockets(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/ws?access_token=abc", nil)
+	if got := Credential(req); got != "" {
+		t.Fatalf("expected query token to be ignored, got %q", got)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	if got := Credential(req); got != "abc" {
+		t.Fatalf("expected websocket query token, got %q", got)
+	}
+}
+
+func TestMiddlewareDisabledPassesThrough(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(New(nil, nil), func(*http.Request) (Scope, bool) { return ScopeAdmin, true }, next)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected disabled auth to admit requests, got %d", rec.Code)
+	}
+}
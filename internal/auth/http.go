@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// ScopeFunc returns the scope a request needs. An empty scope admits any
+// authenticated caller; ok=false marks the request as public.
+type ScopeFunc func(r *http.Request) (scope Scope, ok bool)
+
+// Middleware authenticates requests and enforces the scope scopeFor returns.
+// The caller's identity is stored in the request context. Unauthenticated
+// requests get 401 and callers without the scope 403. When a is disabled,
+// requests pass through unchanged.
+func Middleware(a *Authenticator, scopeFor ScopeFunc, next http.Handler) http.Handler {
+	if !a.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := scopeFor(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := a.Authenticate(Credential(r))
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) {
+				slog.WarnContext(r.Context(), "authentication failed", "path", r.URL.Path, "err", err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gateway"`)
+			message := "authentication required"
+			if errors.Is(err, ErrTokenExpired) {
+				message = "token expired"
+			}
+			http.Error(w, message, http.StatusUnauthorized)
+			return
+		}
+		if scope != "" && !id.Allows(scope) {
+			slog.WarnContext(r.Context(), "insufficient scope", "path", r.URL.Path, "subject", id.Subject, "scope", scope)
+			http.Error(w, "missing scope "+string(scope), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Key is one static API key.
+type Key struct {
+	Name          string
+	Scopes        []Scope
+	MaxActiveJobs int
+	digest        [sha256.Size]byte
+}
+
+// keyFile is the JSON layout read by LoadKeys:
+//
+//	{"keys": [
+//	  {"name": "ci", "key": "<secret>", "scopes": ["submit", "read"]},
+//	  {"name": "ops", "key_sha256": "<hex sha256 of secret>", "scopes": ["admin"], "max_active_jobs": 50}
+//	]}
+//
+// key_sha256 lets the file hold digests instead of the keys themselves, and
+// max_active_jobs overrides the gateway's default job quota for that key.
+type keyFile struct {
+	Keys []keyEntry `json:"keys"`
+}
+
+type keyEntry struct {
+	Name      string   `json:"name"`
+	Key       string   `json:"key"`
+	KeySHA256 string   `json:"key_sha256"`
+	Scopes    []string `json:"scopes"`
+	MaxActive int      `json:"max_active_jobs"`
+}
+
+// LoadKeys reads API keys from a JSON file.
+func LoadKeys(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: read keys: %w", err)
+	}
+	keys, err := ParseKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseKeys decodes the key file format described on keyFile.
+func ParseKeys(data []byte) ([]Key, error) {
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(file.Keys))
+	names := make(map[string]bool, len(file.Keys))
+	digests := make(map[[sha256.Size]byte]bool, len(file.Keys))
+	for i, entry := range file.Keys {
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			return nil, fmt.Errorf("key %d: missing name", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("key %q: duplicate name", name)
+		}
+		names[name] = true
+
+		if entry.MaxActive < 0 {
+			return nil, fmt.Errorf("key %q: max_active_jobs must not be negative", name)
+		}
+		key := Key{Name: name, MaxActiveJobs: entry.MaxActive}
+		switch {
+		case entry.Key != "" && entry.KeySHA256 != "":
+			return nil, fmt.Errorf("key %q: set key or key_sha256, not both", name)
+		case entry.Key != "":
+			if len(entry.Key) < 16 {
+				return nil, fmt.Errorf("key %q: key must be at least 16 characters", name)
+			}
+			key.digest = sha256.Sum256([]byte(entry.Key))
+		case entry.KeySHA256 != "":
+			raw, err := hex.DecodeString(entry.KeySHA256)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("key %q: key_sha256 must be 64 hex characters", name)
+			}
+			copy(key.digest[:], raw)
+		default:
+			return nil, fmt.Errorf("key %q: missing key", name)
+		}
+		if digests[key.digest] {
+			return nil, fmt.Errorf("key %q: duplicate key", name)
+		}
+		digests[key.digest] = true
+
+		if len(entry.Scopes) == 0 {
+			return nil, fmt.Errorf("key %q: no scopes", name)
+		}
+		for _, raw := range entry.Scopes {
+			scope, err := ParseScope(raw)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", name, err)
+			}
+			key.Scopes = append(key.Scopes, scope)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys defined")
+	}
+	return keys, nil
+}
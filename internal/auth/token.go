@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tokenPrefix marks bearer tokens so they are not mistaken for API keys.
+const tokenPrefix = "cst1."
+
+// MinSecretLength is the shortest accepted token signing secret.
+const MinSecretLength = 32
+
+type tokenClaims struct {
+	Subject       string  `json:"sub"`
+	Scopes        []Scope `json:"scopes"`
+	MaxActiveJobs int     `json:"max_active,omitempty"`
+	IssuedAt      int64   `json:"iat"`
+	ExpiresAt     int64   `json:"exp"`
+}
+
+// IssueToken signs a token for grant's subject, scopes and MaxActiveJobs,
+// valid for ttl; the quota travels with the token so it cannot be used to
+// escape the limit of the key that minted it. Tokens are
+// "cst1.<base64url claims>.<base64url HMAC-SHA256>".
+func (a *Authenticator) IssueToken(grant Identity, ttl time.Duration) (string, time.Time, error) {
+	if !a.TokensEnabled() {
+		return "", time.Time{}, errors.New("auth: token signing secret not configured")
+	}
+	if grant.Subject == "" || len(grant.Scopes) == 0 || ttl <= 0 {
+		return "", time.Time{}, errors.New("auth: token needs a subject, scopes and a positive ttl")
+	}
+	now := a.now()
+	expires := now.Add(ttl).Truncate(time.Second)
+	payload, err := json.Marshal(tokenClaims{
+		Subject:       grant.Subject,
+		Scopes:        grant.Scopes,
+		MaxActiveJobs: grant.MaxActiveJobs,
+		IssuedAt:      now.Unix(),
+		ExpiresAt:     expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	body := tokenPrefix + base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(a.sign(body)), expires, nil
+}
+
+func (a *Authenticator) verifyToken(token string) (Identity, error) {
+	dot := strings.LastIndexByte(token, '.')
+	if dot <= len(tokenPrefix) {
+		return Identity{}, ErrInvalidCredentials
+	}
+	body := token[:dot]
+	signature, err := base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil || !hmac.Equal(signature, a.sign(body)) {
+		return Identity{}, ErrInvalidCredentials
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(body, tokenPrefix))
+	if err != nil {
+		return Identity{}, ErrInvalidCredentials
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+	for _, scope := range claims.Scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return Identity{}, ErrInvalidCredentials
+		}
+	}
+	expires := time.Unix(claims.ExpiresAt, 0)
+	if !a.now().Before(expires) {
+		return Identity{}, fmt.Errorf("%w at %s", ErrTokenExpired, expires.UTC().Format(time.RFC3339))
+	}
+	return Identity{
+		Subject:       claims.Subject,
+		Scopes:        claims.Scopes,
+		Method:        MethodToken,
+		ExpiresAt:     expires,
+		MaxActiveJobs: claims.MaxActiveJobs,
+	}, nil
+}
+
+func (a *Authenticator) sign(body string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,196 @@
+// Package grpctls builds TLS and mutual-TLS credentials for the gRPC links
+// between the gateway, orchestrator and stage services.
+package grpctls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config locates a service's certificate and the CA it trusts. A zero Config
+// means plaintext.
+type Config struct {
+	// CertFile and KeyFile are this service's PEM certificate and key. Servers
+	// need them; clients present them when the server asks (mTLS).
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM bundle that signs peers. Clients fall back to the
+	// system roots without it; servers need it to verify client certificates.
+	CAFile string
+	// ServerName overrides the name clients expect in the server certificate,
+	// which otherwise is the host of the dial target.
+	ServerName string
+	// ClientAuth makes servers require a client certificate signed by CAFile.
+	ClientAuth bool
+	// AllowedClients restricts servers to client certificates naming one of
+	// these identities (DNS or URI SAN, or common name). Setting it implies
+	// ClientAuth.
+	AllowedClients []string
+}
+
+// FromEnv reads GRPC_TLS_CERT, GRPC_TLS_KEY, GRPC_TLS_CA,
+// GRPC_TLS_SERVER_NAME, GRPC_TLS_CLIENT_AUTH and GRPC_TLS_ALLOWED_CLIENTS.
+func FromEnv() (Config, error) {
+	cfg := Config{
+		CertFile:   os.Getenv("GRPC_TLS_CERT"),
+		KeyFile:    os.Getenv("GRPC_TLS_KEY"),
+		CAFile:     os.Getenv("GRPC_TLS_CA"),
+		ServerName: os.Getenv("GRPC_TLS_SERVER_NAME"),
+	}
+	if raw := os.Getenv("GRPC_TLS_CLIENT_AUTH"); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("grpctls: GRPC_TLS_CLIENT_AUTH: %w", err)
+		}
+		cfg.ClientAuth = enabled
+	}
+	for _, name := range strings.Split(os.Getenv("GRPC_TLS_ALLOWED_CLIENTS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.AllowedClients = append(cfg.AllowedClients, name)
+		}
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether any TLS material is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+func (c Config) mutual() bool {
+	return c.ClientAuth || len(c.AllowedClients) > 0
+}
+
+// ServerTLS returns the listener TLS config.
+func (c Config) ServerTLS() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("grpctls: servers need a certificate and key")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("grpctls: load key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.mutual() {
+		if c.CAFile == "" {
+			return nil, errors.New("grpctls: client authentication needs a CA")
+		}
+		pool, err := loadPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if len(c.AllowedClients) > 0 {
+			allowed := c.AllowedClients
+			cfg.VerifyConnection = func(state tls.ConnectionState) error {
+				if len(state.PeerCertificates) == 0 {
+					return errors.New("grpctls: no client certificate")
+				}
+				return checkPeer(state.PeerCertificates[0], allowed)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// ClientTLS returns the dialer TLS config.
+func (c Config) ClientTLS() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		pool, err := loadPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpctls: load key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// ServerOption returns the transport credentials for grpc.NewServer:
+// TLS when configured, plaintext otherwise.
+func (c Config) ServerOption() (grpc.ServerOption, error) {
+	if !c.Enabled() {
+		return grpc.Creds(insecure.NewCredentials()), nil
+	}
+	cfg, err := c.ServerTLS()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(credentials.NewTLS(cfg)), nil
+}
+
+// DialOption returns the transport credentials for grpc.Dial: TLS when
+// configured, plaintext otherwise.
+func (c Config) DialOption() (grpc.DialOption, error) {
+	if !c.Enabled() {
+		return grpc.WithTransportCredentials(insecure.NewCredentials()), nil
+	}
+	cfg, err := c.ClientTLS()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(cfg)), nil
+}
+
+// Mode describes the config for startup logs: "plaintext", "tls" or "mtls".
+func (c Config) Mode() string {
+	switch {
+	case !c.Enabled():
+		return "plaintext"
+	case c.mutual():
+		return "mtls"
+	}
+	return "tls"
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("grpctls: read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("grpctls: no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// checkPeer accepts cert if any of its DNS or URI SANs, or its common name,
+// is in allowed.
+func checkPeer(cert *x509.Certificate, allowed []string) error {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, name := range names {
+		for _, want := range allowed {
+			if name != "" && strings.EqualFold(name, want) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("grpctls: peer %q is not an allowed client", cert.Subject.CommonName)
+}
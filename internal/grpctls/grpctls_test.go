@@ -0,0 +1,143 @@
+package grpctls
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+
+	"google.golang.org/grpc"
+)
+
+type healthServer struct {
+	orchestratorv1.UnimplementedStageRunnerServer
+}
+
+func (healthServer) Health(context.Context, *orchestratorv1.HealthRequest) (*orchestratorv1.HealthResponse, error) {
+	return &orchestratorv1.HealthResponse{Status: "ok"}, nil
+}
+
+func writeDevCerts(t *testing.T, names ...string) string {
+	t.Helper()
+	ca, err := NewDevCA("test-ca", time.Hour)
+	if err != nil {
+		t.Fatalf("new CA: %v", err)
+	}
+	dir := t.TempDir()
+	if err := ca.WriteFiles(dir, names, []string{"localhost", "127.0.0.1"}, time.Hour); err != nil {
+		t.Fatalf("write certs: %v", err)
+	}
+	return dir
+}
+
+func serve(t *testing.T, cfg Config) string {
+	t.Helper()
+	option, err := cfg.ServerOption()
+	if err != nil {
+		t.Fatalf("server option: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer(option)
+	orchestratorv1.RegisterStageRunnerServer(server, healthServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func health(t *testing.T, addr string, cfg Config) error {
+	t.Helper()
+	option, err := cfg.DialOption()
+	if err != nil {
+		t.Fatalf("dial option: %v", err)
+	}
+	conn, err := grpc.Dial(addr, option)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = orchestratorv1.NewStageRunnerClient(conn).Health(ctx, &orchestratorv1.HealthRequest{})
+	return err
+}
+
+func certConfig(dir, name string) Config {
+	return Config{
+		CertFile: filepath.Join(dir, name+".pem"),
+		KeyFile:  filepath.Join(dir, name+"-key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+}
+
+func TestMutualTLSChecksClientIdentity(t *testing.T) {
+	dir := writeDevCerts(t, "stage-sampler", "orchestrator", "gateway")
+	server := certConfig(dir, "stage-sampler")
+	server.AllowedClients = []string{"orchestrator"}
+	addr := serve(t, server)
+
+	orchestrator := certConfig(dir, "orchestrator")
+	orchestrator.ServerName = "stage-sampler"
+	if err := health(t, addr, orchestrator); err != nil {
+		t.Fatalf("expected allowed client to connect: %v", err)
+	}
+
+	gateway := certConfig(dir, "gateway")
+	gateway.ServerName = "stage-sampler"
+	if err := health(t, addr, gateway); err == nil {
+		t.Fatal("expected client outside the allowlist to be rejected")
+	}
+
+	anonymous := Config{CAFile: filepath.Join(dir, "ca.pem"), ServerName: "stage-sampler"}
+	if err := health(t, addr, anonymous); err == nil {
+		t.Fatal("expected client without a certificate to be rejected")
+	}
+}
+
+func TestClientVerifiesServerName(t *testing.T) {
+	dir := writeDevCerts(t, "stage-sampler")
+	addr := serve(t, certConfig(dir, "stage-sampler"))
+
+	client := Config{CAFile: filepath.Join(dir, "ca.pem")}
+	if err := health(t, addr, client); err != nil {
+		t.Fatalf("expected 127.0.0.1 SAN to verify: %v", err)
+	}
+	client.ServerName = "orchestrator"
+	if err := health(t, addr, client); err == nil {
+		t.Fatal("expected a server name mismatch to fail")
+	}
+
+	otherCA := writeDevCerts(t)
+	if err := health(t, addr, Config{CAFile: filepath.Join(otherCA, "ca.pem")}); err == nil {
+		t.Fatal("expected a certificate from another CA to fail")
+	}
+}
+
+func TestPlaintextWhenUnconfigured(t *testing.T) {
+	addr := serve(t, Config{})
+	if err := health(t, addr, Config{}); err != nil {
+		t.Fatalf("expected plaintext round trip: %v", err)
+	}
+	if mode := (Config{}).Mode(); mode != "plaintext" {
+		t.Fatalf("unexpected mode %q", mode)
+	}
+}
+
+func TestServerConfigErrors(t *testing.T) {
+	dir := writeDevCerts(t, "stage-sampler")
+	if _, err := (Config{CAFile: filepath.Join(dir, "ca.pem")}).ServerTLS(); err == nil {
+		t.Fatal("expected a server without a key pair to fail")
+	}
+	cfg := certConfig(dir, "stage-sampler")
+	cfg.CAFile = ""
+	cfg.ClientAuth = true
+	if _, err := cfg.ServerTLS(); err == nil || !strings.Contains(err.Error(), "CA") {
+		t.Fatalf("expected client auth without a CA to fail, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !imagick
+
+package imaging
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestEncodeWebPNeedsImagick(t *testing.T) {
+	if _, err := encode(image.NewRGBA(image.Rect(0, 0, 1, 1)), FormatWebP, 0); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected unsupported format, got %v", err)
+	}
+}
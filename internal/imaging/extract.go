@@ -0,0 +1,189 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoWorkflow is returned when an image carries no embedded ComfyUI graph.
+var ErrNoWorkflow = errors.New("no embedded workflow")
+
+// EmbeddedWorkflow is the ComfyUI graph found in an image. Workflow is the
+// UI (litegraph) save format and Prompt the API format; either may be nil.
+type EmbeddedWorkflow struct {
+	Container string
+	Workflow  json.RawMessage
+	Prompt    json.RawMessage
+}
+
+// ExtractWorkflow looks for ComfyUI "workflow" and "prompt" JSON in PNG text
+// chunks, or in EXIF ASCII tags of JPEG and WebP files, where ComfyUI writes
+// them as "workflow:<json>" and "prompt:<json>".
+func ExtractWorkflow(data []byte) (*EmbeddedWorkflow, error) {
+	var (
+		container string
+		entries   []TextChunk
+		err       error
+	)
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		container = "png"
+		entries, err = ReadText(data)
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		container = "jpeg"
+		entries, err = jpegEXIFText(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		container = "webp"
+		entries, err = webpEXIFText(data)
+	default:
+		return nil, fmt.Errorf("%w: unrecognised image container", ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	found := &EmbeddedWorkflow{Container: container}
+	for _, entry := range entries {
+		keyword := strings.ToLower(entry.Keyword)
+		text := strings.TrimSpace(entry.Text)
+		if !json.Valid([]byte(text)) {
+			continue
+		}
+		switch keyword {
+		case "workflow":
+			if found.Workflow == nil {
+				found.Workflow = json.RawMessage(text)
+			}
+		case "prompt":
+			if found.Prompt == nil {
+				found.Prompt = json.RawMessage(text)
+			}
+		}
+	}
+	if found.Workflow == nil && found.Prompt == nil {
+		return nil, ErrNoWorkflow
+	}
+	return found, nil
+}
+
+// jpegEXIFText walks JPEG markers up to the image data and decodes the first
+// APP1 Exif segment.
+func jpegEXIFText(data []byte) ([]TextChunk, error) {
+	rest := data[2:]
+	for len(rest) >= 4 {
+		if rest[0] != 0xff {
+			return nil, fmt.Errorf("%w: malformed jpeg marker", ErrUnsupportedFormat)
+		}
+		marker := rest[1]
+		if marker == 0xd9 || marker == 0xda {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(rest[2:4]))
+		if length < 2 || 2+length > len(rest) {
+			return nil, fmt.Errorf("%w: truncated jpeg segment", ErrUnsupportedFormat)
+		}
+		segment := rest[4 : 2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifText(segment[6:])
+		}
+		rest = rest[2+length:]
+	}
+	return nil, nil
+}
+
+// webpEXIFText finds the EXIF chunk of a RIFF WebP file.
+func webpEXIFText(data []byte) ([]TextChunk, error) {
+	rest := data[12:]
+	for len(rest) >= 8 {
+		kind := string(rest[:4])
+		length := int(binary.LittleEndian.Uint32(rest[4:8]))
+		if length < 0 || 8+length > len(rest) {
+			return nil, fmt.Errorf("%w: truncated webp chunk", ErrUnsupportedFormat)
+		}
+		if kind == "EXIF" {
+			// Some writers keep the JPEG-style "Exif\0\0" header.
+			return exifText(bytes.TrimPrefix(rest[8:8+length], []byte("Exif\x00\x00")))
+		}
+		next := 8 + length + length%2
+		if next > len(rest) {
+			// A final odd-length chunk may be missing its pad byte.
+			break
+		}
+		rest = rest[next:]
+	}
+	return nil, nil
+}
+
+const (
+	exifTypeASCII     = 2
+	exifTypeUndefined = 7
+	exifTagExifIFD    = 0x8769
+)
+
+// exifText decodes the ASCII and UNDEFINED tags of IFD0 and the Exif sub-IFD.
+// Values of the form "key:text" become TextChunks with that key; other values
+// are returned with an empty keyword.
+func exifText(tiff []byte) ([]TextChunk, error) {
+	if len(tiff) < 8 {
+		return nil, fmt.Errorf("%w: truncated exif", ErrUnsupportedFormat)
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: bad exif byte order", ErrUnsupportedFormat)
+	}
+
+	var chunks []TextChunk
+	offsets := []uint32{order.Uint32(tiff[4:8])}
+	for visited := 0; len(offsets) > 0 && visited < 4; visited++ {
+		offset := int(offsets[0])
+		offsets = offsets[1:]
+		if offset < 8 || offset+2 > len(tiff) {
+			continue
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entry := offset + 2 + i*12
+			if entry+12 > len(tiff) {
+				break
+			}
+			tag := order.Uint16(tiff[entry:])
+			kind := order.Uint16(tiff[entry+2:])
+			size := int(order.Uint32(tiff[entry+4:]))
+			if tag == exifTagExifIFD {
+				offsets = append(offsets, order.Uint32(tiff[entry+8:]))
+				continue
+			}
+			if kind != exifTypeASCII && kind != exifTypeUndefined {
+				continue
+			}
+			value := tiff[entry+8 : entry+12]
+			if size > 4 {
+				start := int(order.Uint32(tiff[entry+8:]))
+				if start < 0 || size < 0 || start+size > len(tiff) {
+					continue
+				}
+				value = tiff[start : start+size]
+			} else {
+				value = value[:size]
+			}
+			text := strings.TrimRight(string(value), "\x00")
+			// UserComment starts with an 8-byte character code.
+			text = strings.TrimPrefix(text, "ASCII\x00\x00\x00")
+			keyword, body, ok := strings.Cut(text, ":")
+			if !ok {
+				keyword, body = "", text
+			}
+			chunks = append(chunks, TextChunk{Keyword: keyword, Text: body})
+		}
+	}
+	return chunks, nil
+}
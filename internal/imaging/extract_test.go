@@ -0,0 +1,109 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+const testWorkflow = `{"nodes":[{"id":3,"type":"KSampler"}]}`
+
+func TestExtractWorkflowFromPNG(t *testing.T) {
+	payload, err := RenderPlaceholder(RenderOptions{
+		Width: 16, Height: 16,
+		Text: Provenance{Workflow: testWorkflow, Prompt: `{"3":{"class_type":"KSampler","inputs":{}}}`}.TextChunks(),
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	found, err := ExtractWorkflow(payload)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if found.Container != "png" || string(found.Workflow) != testWorkflow || found.Prompt == nil {
+		t.Fatalf("unexpected extraction %+v", found)
+	}
+}
+
+func TestExtractWorkflowFromJPEGExif(t *testing.T) {
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	exif := append([]byte("Exif\x00\x00"), testTIFF("Workflow:"+testWorkflow)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	payload := append(append(append([]byte{0xff, 0xd8}, segment...), exif...), plain.Bytes()[2:]...)
+
+	found, err := ExtractWorkflow(payload)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if found.Container != "jpeg" || string(found.Workflow) != testWorkflow {
+		t.Fatalf("unexpected extraction %+v", found)
+	}
+}
+
+func TestExtractWorkflowFromWebPExif(t *testing.T) {
+	exif := testTIFF("prompt:" + testWorkflow)
+	chunk := append([]byte("EXIF\x00\x00\x00\x00"), exif...)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(exif)))
+	if len(exif)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	payload := append([]byte("RIFF\x00\x00\x00\x00WEBP"), chunk...)
+	binary.LittleEndian.PutUint32(payload[4:], uint32(len(payload)-8))
+
+	found, err := ExtractWorkflow(payload)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if found.Container != "webp" || string(found.Prompt) != testWorkflow || found.Workflow != nil {
+		t.Fatalf("unexpected extraction %+v", found)
+	}
+}
+
+func TestExtractWorkflowRejectsMalformedWebPChunks(t *testing.T) {
+	webp := func(chunks ...byte) []byte {
+		payload := append([]byte("RIFF\x00\x00\x00\x00WEBP"), chunks...)
+		binary.LittleEndian.PutUint32(payload[4:], uint32(len(payload)-8))
+		return payload
+	}
+	// An odd-length last chunk without its pad byte ends the scan.
+	if _, err := ExtractWorkflow(webp([]byte("VP8X\x03\x00\x00\x00abc")...)); !errors.Is(err, ErrNoWorkflow) {
+		t.Fatalf("expected ErrNoWorkflow for an unpadded last chunk, got %v", err)
+	}
+	// A chunk claiming more bytes than remain is rejected.
+	if _, err := ExtractWorkflow(webp([]byte("VP8X\x10\x00\x00\x00abc")...)); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected a truncated chunk error, got %v", err)
+	}
+}
+
+func TestExtractWorkflowMissing(t *testing.T) {
+	payload, err := RenderPlaceholder(RenderOptions{Width: 8, Height: 8, Text: []TextChunk{{Keyword: "workflow", Text: "not json"}}})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if _, err := ExtractWorkflow(payload); !errors.Is(err, ErrNoWorkflow) {
+		t.Fatalf("expected ErrNoWorkflow, got %v", err)
+	}
+	if _, err := ExtractWorkflow([]byte("GIF89a")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected unsupported container, got %v", err)
+	}
+}
+
+// testTIFF builds a little-endian TIFF header with one ASCII Make (0x010F) tag.
+func testTIFF(value string) []byte {
+	text := append([]byte(value), 0)
+	out := []byte("II*\x00\x08\x00\x00\x00")
+	out = binary.LittleEndian.AppendUint16(out, 1)
+	out = binary.LittleEndian.AppendUint16(out, 0x010f)
+	out = binary.LittleEndian.AppendUint16(out, exifTypeASCII)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(text)))
+	out = binary.LittleEndian.AppendUint32(out, uint32(8+2+12+4))
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	return append(out, text...)
+}
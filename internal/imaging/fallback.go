@@ -8,6 +8,7 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"image/jpeg"
 	"image/png"
 )
 
@@ -39,9 +40,26 @@ func renderPlaceholder(opts RenderOptions) ([]byte, error) {
 	drawSimpleText(img, 32, 50, label)
 	drawSimpleText(img, 32, 80, "prompt: "+trimText(opts.Prompt, 48))
 
+	return encode(img, opts.Format, opts.Quality)
+}
+
+// encode writes img in the requested format. The standard library has no
+// WebP encoder, so WebP output needs the imagick build.
+func encode(img image.Image, format Format, q int) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := png.Encode(&buf, img); err != nil {
-		return nil, err
+	switch format {
+	case "", FormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case FormatJPEG:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality(q)}); err != nil {
+			return nil, err
+		}
+	case FormatWebP:
+		return nil, fmt.Errorf("%w: webp requires the imagick build", ErrUnsupportedFormat)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
 	}
 	return buf.Bytes(), nil
 }
@@ -2,6 +2,8 @@ package imaging
 
 import (
 	"bytes"
+	"image"
+	_ "image/jpeg"
 	"image/png"
 	"testing"
 )
@@ -35,3 +37,17 @@ func TestRenderPlaceholderDefaults(t *testing.T) {
 		t.Fatalf("unexpected default size: %dx%d", bounds.Dx(), bounds.Dy())
 	}
 }
+
+func TestRenderPlaceholderJPEG(t *testing.T) {
+	payload, err := RenderPlaceholder(RenderOptions{Width: 64, Height: 48, Format: FormatJPEG, Quality: 70})
+	if err != nil {
+		t.Fatalf("render placeholder: %v", err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if format != "jpeg" || img.Bounds().Dx() != 64 {
+		t.Fatalf("unexpected %s image %v", format, img.Bounds())
+	}
+}
@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Format names an output encoding selected by a SaveImage node.
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+// DefaultQuality is used for lossy formats when no quality is requested.
+const DefaultQuality = 90
+
+// ErrUnsupportedFormat is returned for unknown formats and for formats the
+// current build cannot encode (WebP needs the imagick build tag).
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ParseFormat maps a widget value such as "PNG", "jpg" or "webp" to a Format.
+// An empty name selects PNG.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, name)
+	}
+}
+
+// Extension returns the file extension used for artifact names, without a dot.
+func (f Format) Extension() string {
+	if f == FormatJPEG {
+		return "jpg"
+	}
+	if f == "" {
+		return string(FormatPNG)
+	}
+	return string(f)
+}
+
+// ContentType returns the MIME type served for f, which is also the TensorRef dtype.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
+
+// quality clamps q to 1-100, substituting DefaultQuality for zero or negative values.
+func quality(q int) int {
+	if q <= 0 {
+		return DefaultQuality
+	}
+	if q > 100 {
+		return 100
+	}
+	return q
+}
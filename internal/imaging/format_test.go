@@ -0,0 +1,28 @@
+package imaging
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	cases := map[string]Format{"": FormatPNG, "PNG": FormatPNG, "jpg": FormatJPEG, "JPEG": FormatJPEG, " webp ": FormatWebP}
+	for name, want := range cases {
+		got, err := ParseFormat(name)
+		if err != nil || got != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("gif"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected unsupported format, got %v", err)
+	}
+	if FormatJPEG.Extension() != "jpg" || FormatJPEG.ContentType() != "image/jpeg" || FormatWebP.ContentType() != "image/webp" {
+		t.Fatalf("unexpected jpeg/webp naming")
+	}
+}
+
+func TestQualityClamp(t *testing.T) {
+	if quality(0) != DefaultQuality || quality(150) != 100 || quality(42) != 42 {
+		t.Fatalf("unexpected quality clamping")
+	}
+}
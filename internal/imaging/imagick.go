@@ -31,8 +31,17 @@ func renderPlaceholder(opts RenderOptions) ([]byte, error) {
 		return nil, err
 	}
 
-	if err := mw.SetImageFormat("png"); err != nil {
-		return nil, err
+	format := opts.Format
+	if format == "" {
+		format = FormatPNG
+	}
+	if err := mw.SetImageFormat(string(format)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if format != FormatPNG {
+		if err := mw.SetImageCompressionQuality(uint(quality(opts.Quality))); err != nil {
+			return nil, err
+		}
 	}
 
 	draw := imagick.NewDrawingWand()
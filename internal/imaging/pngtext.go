@@ -0,0 +1,195 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// pngSignature starts every PNG stream.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ErrNotPNG is returned when text chunks are read from or written to non-PNG data.
+var ErrNotPNG = errors.New("not a png image")
+
+// TextChunk is a PNG text entry. Keywords are 1-79 Latin-1 characters; text
+// that is not Latin-1 is written as an uncompressed UTF-8 iTXt chunk.
+type TextChunk struct {
+	Keyword string
+	Text    string
+}
+
+// Provenance records how an output was generated. Workflow holds the
+// UI-format graph and Prompt the API-format graph, under the keys ComfyUI
+// reads when an image is dropped onto the canvas.
+type Provenance struct {
+	Positive   string
+	Negative   string
+	Checkpoint string
+	Seed       int64
+	Steps      int
+	Cfg        string
+	Sampler    string
+	Scheduler  string
+	Workflow   string
+	Prompt     string
+}
+
+// TextChunks returns the non-empty provenance fields as text chunks.
+func (p Provenance) TextChunks() []TextChunk {
+	var chunks []TextChunk
+	add := func(keyword, text string) {
+		if text != "" {
+			chunks = append(chunks, TextChunk{Keyword: keyword, Text: text})
+		}
+	}
+	add("prompt", p.Prompt)
+	add("workflow", p.Workflow)
+	add("positive", p.Positive)
+	add("negative", p.Negative)
+	add("checkpoint", p.Checkpoint)
+	add("seed", strconv.FormatInt(p.Seed, 10))
+	if p.Steps > 0 {
+		add("steps", strconv.Itoa(p.Steps))
+	}
+	add("cfg", p.Cfg)
+	add("sampler", p.Sampler)
+	add("scheduler", p.Scheduler)
+	return chunks
+}
+
+// EmbedText inserts text chunks right after the IHDR chunk of a PNG, so
+// readers that stop before the image data still see them.
+func EmbedText(data []byte, chunks []TextChunk) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) || len(data) < len(pngSignature)+8 {
+		return nil, ErrNotPNG
+	}
+	ihdrLength := binary.BigEndian.Uint32(data[len(pngSignature):])
+	ihdrEnd := len(pngSignature) + 12 + int(ihdrLength)
+	if string(data[len(pngSignature)+4:len(pngSignature)+8]) != "IHDR" || ihdrEnd > len(data) {
+		return nil, fmt.Errorf("%w: missing IHDR", ErrNotPNG)
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(data[:ihdrEnd])
+	for _, chunk := range chunks {
+		if err := writeTextChunk(&out, chunk); err != nil {
+			return nil, err
+		}
+	}
+	out.Write(data[ihdrEnd:])
+	return out.Bytes(), nil
+}
+
+func writeTextChunk(out *bytes.Buffer, chunk TextChunk) error {
+	if len(chunk.Keyword) == 0 || len(chunk.Keyword) > 79 || !isLatin1(chunk.Keyword) || strings.ContainsRune(chunk.Keyword, 0) {
+		return fmt.Errorf("invalid png text keyword %q", chunk.Keyword)
+	}
+	var body bytes.Buffer
+	body.WriteString(chunk.Keyword)
+	body.WriteByte(0)
+	if latin1, ok := toLatin1(chunk.Text); ok {
+		body.Write(latin1)
+		writeChunk(out, "tEXt", body.Bytes())
+		return nil
+	}
+	// iTXt: compression flag, method, empty language tag and translated keyword.
+	body.Write([]byte{0, 0, 0, 0})
+	body.WriteString(chunk.Text)
+	writeChunk(out, "iTXt", body.Bytes())
+	return nil
+}
+
+func writeChunk(out *bytes.Buffer, kind string, body []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(body)))
+	copy(header[4:], kind)
+	out.Write(header[:])
+	out.Write(body)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	out.Write(sum[:])
+}
+
+// ReadText returns the uncompressed tEXt and iTXt entries of a PNG in file
+// order. Compressed (zTXt or compressed iTXt) entries are skipped.
+func ReadText(data []byte) ([]TextChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrNotPNG
+	}
+	var chunks []TextChunk
+	rest := data[len(pngSignature):]
+	for len(rest) >= 12 {
+		length := int(binary.BigEndian.Uint32(rest))
+		if length < 0 || 12+length > len(rest) {
+			return nil, fmt.Errorf("%w: truncated chunk", ErrNotPNG)
+		}
+		kind := string(rest[4:8])
+		body := rest[8 : 8+length]
+		switch kind {
+		case "tEXt":
+			if keyword, text, ok := bytes.Cut(body, []byte{0}); ok {
+				chunks = append(chunks, TextChunk{Keyword: latin1String(keyword), Text: latin1String(text)})
+			}
+		case "iTXt":
+			if chunk, ok := parseITXt(body); ok {
+				chunks = append(chunks, chunk)
+			}
+		case "IEND":
+			return chunks, nil
+		}
+		rest = rest[12+length:]
+	}
+	return chunks, nil
+}
+
+func parseITXt(body []byte) (TextChunk, bool) {
+	keyword, rest, ok := bytes.Cut(body, []byte{0})
+	if !ok || len(rest) < 2 || rest[0] != 0 {
+		return TextChunk{}, false
+	}
+	rest = rest[2:]
+	// Skip the language tag and translated keyword.
+	for i := 0; i < 2; i++ {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return TextChunk{}, false
+		}
+	}
+	if !utf8.Valid(rest) {
+		return TextChunk{}, false
+	}
+	return TextChunk{Keyword: latin1String(keyword), Text: string(rest)}, true
+}
+
+func isLatin1(s string) bool {
+	_, ok := toLatin1(s)
+	return ok
+}
+
+func toLatin1(s string) ([]byte, bool) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff || r == utf8.RuneError {
+			return nil, false
+		}
+		out = append(out, byte(r))
+	}
+	return out, true
+}
+
+func latin1String(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,60 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+func TestEmbedTextRoundTrip(t *testing.T) {
+	workflow := `{"nodes":[{"id":1,"type":"CLIPTextEncode","widgets_values":["café ☕"]}]}`
+	payload, err := RenderPlaceholder(RenderOptions{
+		Width:  32,
+		Height: 32,
+		Text: Provenance{
+			Positive: "a lighthouse",
+			Seed:     42,
+			Steps:    20,
+			Cfg:      "7.50",
+			Workflow: workflow,
+		}.TextChunks(),
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(payload)); err != nil {
+		t.Fatalf("embedded png no longer decodes: %v", err)
+	}
+
+	chunks, err := ReadText(payload)
+	if err != nil {
+		t.Fatalf("read text: %v", err)
+	}
+	got := map[string]string{}
+	for _, chunk := range chunks {
+		got[chunk.Keyword] = chunk.Text
+	}
+	if got["workflow"] != workflow || got["positive"] != "a lighthouse" || got["seed"] != "42" || got["steps"] != "20" || got["cfg"] != "7.50" {
+		t.Fatalf("unexpected text chunks %v", got)
+	}
+	if _, ok := got["prompt"]; ok {
+		t.Fatalf("empty prompt should not be embedded")
+	}
+	if !bytes.Contains(payload, []byte("iTXtworkflow")) || !bytes.Contains(payload, []byte("tEXtpositive")) {
+		t.Fatalf("expected iTXt for non-Latin-1 text and tEXt otherwise")
+	}
+}
+
+func TestEmbedTextRejectsBadInput(t *testing.T) {
+	if _, err := EmbedText([]byte("GIF89a"), nil); !errors.Is(err, ErrNotPNG) {
+		t.Fatalf("expected ErrNotPNG, got %v", err)
+	}
+	payload, err := RenderPlaceholder(RenderOptions{Width: 8, Height: 8})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if _, err := EmbedText(payload, []TextChunk{{Keyword: "", Text: "x"}}); err == nil {
+		t.Fatalf("expected empty keyword to be rejected")
+	}
+}
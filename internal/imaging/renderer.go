@@ -7,8 +7,18 @@ type RenderOptions struct {
 	Negative   string
 	Checkpoint string
 	Seed       int64
+	// Format and Quality select the output encoding; the zero values mean
+	// PNG and DefaultQuality. Quality only affects lossy formats.
+	Format  Format
+	Quality int
+	// Text is embedded as PNG text chunks; other formats ignore it.
+	Text []TextChunk
 }
 
 func RenderPlaceholder(opts RenderOptions) ([]byte, error) {
-	return renderPlaceholder(opts)
+	payload, err := renderPlaceholder(opts)
+	if err != nil || len(opts.Text) == 0 || (opts.Format != "" && opts.Format != FormatPNG) {
+		return payload, err
+	}
+	return EmbedText(payload, opts.Text)
 }
@@ -0,0 +1,169 @@
+package jobid
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// crockford is the ULID alphabet: base32 without I, L, O and U, in ASCII order
+// so encoded ids sort the same way as their binary form.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidLength is the encoded size of a 48-bit timestamp plus 80 random bits.
+const ulidLength = 26
+
+// maxInstanceLength keeps "<instance>-<ulid>" within MaxLength.
+const maxInstanceLength = 16
+
+// Generator produces ids of the form <instance>-<ULID>. The ULID part starts
+// with the millisecond timestamp, so ids from one instance sort lexically in
+// submission order; Compare orders ids from different instances by time.
+// Ids generated within the same millisecond increment the random part, so
+// they stay unique and ordered even under concurrent submissions.
+type Generator struct {
+	instance string
+	now      func() time.Time
+	entropy  io.Reader
+
+	mu       sync.Mutex
+	lastMs   uint64
+	lastRand [10]byte
+}
+
+// NewGenerator returns a generator whose ids start with the sanitized instance name.
+func NewGenerator(instance string) *Generator {
+	return &Generator{instance: SanitizeInstance(instance), now: time.Now, entropy: rand.Reader}
+}
+
+// Instance returns the prefix used for generated ids.
+func (g *Generator) Instance() string {
+	return g.instance
+}
+
+// New returns a fresh job id.
+func (g *Generator) New() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms <= g.lastMs {
+		// Same (or earlier, after a clock step) millisecond: keep the last
+		// timestamp and bump the random part to preserve ordering.
+		ms = g.lastMs
+		if !increment(g.lastRand[:]) {
+			ms++
+			g.fillRandom()
+		}
+	} else {
+		g.fillRandom()
+	}
+	g.lastMs = ms
+	return g.instance + "-" + encode(ms, g.lastRand)
+}
+
+func (g *Generator) fillRandom() {
+	if _, err := io.ReadFull(g.entropy, g.lastRand[:]); err != nil {
+		panic("jobid: entropy source failed: " + err.Error())
+	}
+}
+
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encode(ms uint64, random [10]byte) string {
+	var out [ulidLength]byte
+	for i := 9; i >= 0; i-- {
+		out[i] = crockford[ms&0x1f]
+		ms >>= 5
+	}
+	// 80 random bits as 16 base32 digits, most significant first.
+	hi := uint64(random[0])<<32 | uint64(random[1])<<24 | uint64(random[2])<<16 | uint64(random[3])<<8 | uint64(random[4])
+	lo := uint64(random[5])<<32 | uint64(random[6])<<24 | uint64(random[7])<<16 | uint64(random[8])<<8 | uint64(random[9])
+	for i := 17; i >= 10; i-- {
+		out[i] = crockford[hi&0x1f]
+		hi >>= 5
+	}
+	for i := 25; i >= 18; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo >>= 5
+	}
+	return string(out[:])
+}
+
+// Time returns the creation time embedded in a generated id.
+func Time(id string) (time.Time, bool) {
+	if len(id) < ulidLength+2 || id[len(id)-ulidLength-1] != '-' {
+		return time.Time{}, false
+	}
+	var ms uint64
+	for _, c := range []byte(id[len(id)-ulidLength : len(id)-ulidLength+10]) {
+		index := strings.IndexByte(crockford, c)
+		if index < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | uint64(index)
+	}
+	if ms >= 1<<48 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(ms)), true
+}
+
+// Compare orders ids by their ULID (time first), then by instance. Ids
+// without an embedded time (older wf-<nanos> ids) sort before all generated ids.
+func Compare(a, b string) int {
+	_, okA := Time(a)
+	_, okB := Time(b)
+	switch {
+	case okA && !okB:
+		return 1
+	case !okA && okB:
+		return -1
+	case okA && okB:
+		if c := strings.Compare(a[len(a)-ulidLength:], b[len(b)-ulidLength:]); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// SanitizeInstance lowercases name and keeps only letters and digits, so it
+// is usable as an id prefix. Empty results fall back to "wf".
+func SanitizeInstance(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if b.Len() == maxInstanceLength {
+			break
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "wf"
+	}
+	return b.String()
+}
+
+// DefaultInstance returns ORCHESTRATOR_INSTANCE, else the hostname (the
+// container id under Docker), else "wf".
+func DefaultInstance() string {
+	if instance := os.Getenv("ORCHESTRATOR_INSTANCE"); instance != "" {
+		return instance
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "wf"
+}
@@ -0,0 +1,33 @@
+// Package jobid defines the job identifier format shared by the orchestrator,
+// gateway and stage services. Job ids double as artifact directory names, so
+// anything that accepts an id from a request must validate it first.
+package jobid
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// MaxLength bounds ids so they stay usable as single path segments.
+const MaxLength = 64
+
+var pattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ErrInvalid is returned for ids that do not match the job id format.
+var ErrInvalid = errors.New("invalid job id")
+
+// Validate reports whether id is a well-formed job id: 1-64 ASCII letters,
+// digits, '-' or '_', starting with a letter or digit. The format excludes
+// '.', '/', '\\', '%' and NUL, so a valid id is always one safe path segment.
+func Validate(id string) error {
+	if id == "" || len(id) > MaxLength || !pattern.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalid, id)
+	}
+	return nil
+}
+
+// Valid is Validate as a predicate.
+func Valid(id string) bool {
+	return Validate(id) == nil
+}
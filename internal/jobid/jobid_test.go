@@ -0,0 +1,83 @@
+package jobid
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"wf-1729000000000000000", "job_1", "A", strings.Repeat("a", MaxLength)} {
+		if err := Validate(id); err != nil {
+			t.Fatalf("expected %q to be valid: %v", id, err)
+		}
+	}
+	for _, id := range []string{
+		"", ".", "..", "../../etc", "..%2F..%2Fetc", "a/b", `a\b`, "-leading", "a.b", "a b", "a\x00b",
+		strings.Repeat("a", MaxLength+1),
+	} {
+		if err := Validate(id); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("expected %q to be rejected, got %v", id, err)
+		}
+	}
+}
+
+func TestGeneratorIsSortableAndUnique(t *testing.T) {
+	gen := NewGenerator("Orchestrator-0")
+	fixed := time.UnixMilli(1_700_000_000_000)
+	gen.now = func() time.Time { return fixed }
+
+	seen := make(map[string]bool)
+	prev := ""
+	for i := 0; i < 1000; i++ {
+		id := gen.New()
+		if err := Validate(id); err != nil {
+			t.Fatalf("generated invalid id: %v", err)
+		}
+		if !strings.HasPrefix(id, "orchestrator0-") {
+			t.Fatalf("unexpected prefix in %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+		if prev != "" && id <= prev {
+			t.Fatalf("ids not monotonic: %q after %q", id, prev)
+		}
+		prev = id
+	}
+
+	created, ok := Time(prev)
+	if !ok || !created.Equal(fixed) {
+		t.Fatalf("Time(%q) = %v, %v; want %v", prev, created, ok, fixed)
+	}
+
+	gen.now = func() time.Time { return fixed.Add(-time.Second) }
+	if after := gen.New(); after <= prev {
+		t.Fatalf("clock step backwards broke ordering: %q after %q", after, prev)
+	}
+}
+
+func TestCompareOrdersAcrossInstances(t *testing.T) {
+	early := NewGenerator("zeta")
+	early.now = func() time.Time { return time.UnixMilli(1_000) }
+	late := NewGenerator("alpha")
+	late.now = func() time.Time { return time.UnixMilli(2_000) }
+
+	a, b := early.New(), late.New()
+	if Compare(a, b) >= 0 || Compare(b, a) <= 0 {
+		t.Fatalf("expected %q before %q", a, b)
+	}
+	if Compare("wf-1729000000000000000", a) >= 0 {
+		t.Fatalf("legacy ids should sort before generated ids")
+	}
+}
+
+func TestSanitizeInstance(t *testing.T) {
+	for in, want := range map[string]string{"": "wf", "---": "wf", "Orch_01.local": "orch01local", "abcdefghijklmnopqrstuvwxyz": "abcdefghijklmnop"} {
+		if got := SanitizeInstance(in); got != want {
+			t.Fatalf("SanitizeInstance(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/jobid"
+)
+
+const (
+	// JobLogName is the per-job log file written next to a job's artifacts.
+	JobLogName = "job.log"
+	// maxOpenJobLogs bounds the job log files held open; the least recently
+	// written one is closed first and reopened if its job logs again.
+	maxOpenJobLogs = 256
+	// jobLogUploadTimeout bounds copying a finished job's log to the store.
+	jobLogUploadTimeout = 30 * time.Second
+)
+
+type jobLogSink struct {
+	service string
+	root    string
+	// store receives this service's copy of a job log when the job ends. It
+	// is nil when the log file already lives in the shared file store.
+	store artifacts.Store
+
+	mu    sync.Mutex
+	files map[string]*jobLogFile
+}
+
+type jobLogFile struct {
+	file    *os.File
+	written time.Time
+}
+
+var jobSink atomic.Pointer[jobLogSink]
+
+// EnableJobLogs tees every record carrying a job_id into <artifactsRoot>/<job-id>/job.log.
+// Services sharing the artifacts volume append to the same file, so lines are
+// tagged with the service name. With a store other than the file store, the
+// file is local to the service and CloseJobLog uploads it to JobServiceLogKey.
+func EnableJobLogs(serviceName, artifactsRoot string, store artifacts.Store) {
+	sink := &jobLogSink{service: serviceName, root: artifactsRoot, store: store, files: make(map[string]*jobLogFile)}
+	if fileStore, ok := store.(*artifacts.FileStore); ok {
+		sink.root, sink.store = fileStore.Root(), nil
+	}
+	if sink.root == "" {
+		sink = nil
+	}
+	if previous := jobSink.Swap(sink); previous != nil {
+		previous.closeAll()
+	}
+}
+
+// CloseJobLog releases jobID's log file once the service is done with the
+// job, and uploads the service's copy when job logs go to a remote store.
+// Records logged for the job afterwards reopen the file.
+func CloseJobLog(ctx context.Context, jobID string) {
+	if sink := jobSink.Load(); sink != nil {
+		sink.close(ctx, jobID)
+	}
+}
+
+// JobLogPath returns the job log location for jobID under artifactsRoot.
+func JobLogPath(artifactsRoot, jobID string) (string, error) {
+	if err := jobid.Validate(jobID); err != nil {
+		return "", err
+	}
+	return artifacts.SafeJoin(artifactsRoot, jobID, JobLogName)
+}
+
+// JobLogKey returns the artifact store key of jobID's log.
+func JobLogKey(jobID string) (string, error) {
+	if err := jobid.Validate(jobID); err != nil {
+		return "", err
+	}
+	return jobID + "/" + JobLogName, nil
+}
+
+// JobServiceLogKey returns the store key a service uploads its copy of
+// jobID's log to when the store is not a shared directory.
+func JobServiceLogKey(jobID, service string) (string, error) {
+	if err := jobid.Validate(jobID); err != nil {
+		return "", err
+	}
+	return jobID + "/job." + service + ".log", nil
+}
+
+func (s *jobLogSink) write(ctx context.Context, jobID string, record slog.Record) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	if err := handler.WithAttrs([]slog.Attr{slog.String("service", s.service)}).Handle(ctx, record); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := s.openLocked(jobID)
+	if err != nil {
+		return
+	}
+	_, _ = file.Write(buf.Bytes())
+}
+
+// openLocked returns jobID's open log file, opening it on first use.
+// Callers hold s.mu.
+func (s *jobLogSink) openLocked(jobID string) (*os.File, error) {
+	if open, ok := s.files[jobID]; ok {
+		open.written = time.Now()
+		return open.file, nil
+	}
+	path, err := JobLogPath(s.root, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.files) >= maxOpenJobLogs {
+		s.evictLocked()
+	}
+	s.files[jobID] = &jobLogFile{file: file, written: time.Now()}
+	return file, nil
+}
+
+// evictLocked closes the least recently written file. Callers hold s.mu.
+func (s *jobLogSink) evictLocked() {
+	oldest := ""
+	var oldestAt time.Time
+	for id, open := range s.files {
+		if oldest == "" || open.written.Before(oldestAt) {
+			oldest, oldestAt = id, open.written
+		}
+	}
+	if open, ok := s.files[oldest]; ok {
+		_ = open.file.Close()
+		delete(s.files, oldest)
+	}
+}
+
+func (s *jobLogSink) close(ctx context.Context, jobID string) {
+	s.mu.Lock()
+	open, ok := s.files[jobID]
+	delete(s.files, jobID)
+	s.mu.Unlock()
+	if ok {
+		_ = open.file.Close()
+	}
+	if s.store != nil {
+		s.upload(ctx, jobID)
+	}
+}
+
+func (s *jobLogSink) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, open := range s.files {
+		_ = open.file.Close()
+		delete(s.files, id)
+	}
+}
+
+// upload copies the service's local log for jobID to the store. Failures are
+// logged without the job context so they do not reopen the file.
+func (s *jobLogSink) upload(ctx context.Context, jobID string) {
+	path, err := JobLogPath(s.root, jobID)
+	if err != nil {
+		return
+	}
+	key, err := JobServiceLogKey(jobID, s.service)
+	if err != nil {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	// The job may end because its context was cancelled; the upload still runs.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jobLogUploadTimeout)
+	defer cancel()
+	if _, err := s.store.Put(ctx, key, file, "text/plain; charset=utf-8"); err != nil {
+		slog.Warn("job log upload failed", "key", key, "err", err)
+	}
+}
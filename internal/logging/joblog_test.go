@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"comfy-service-tests/internal/artifacts"
+)
+
+func TestJobLogsCaptureRecordsWithJobID(t *testing.T) {
+	root := t.TempDir()
+	EnableJobLogs("orchestrator", root, nil)
+	defer EnableJobLogs("", "", nil)
+
+	logger := slog.New(NewHandler(os.Stderr, "text", slog.LevelInfo))
+	logger.InfoContext(WithStage(WithJob(context.Background(), "wf-9"), "text_to_image"), "stage started")
+	logger.InfoContext(context.Background(), "no job here")
+	logger.DebugContext(WithJob(context.Background(), "wf-9"), "below threshold")
+
+	data, err := os.ReadFile(filepath.Join(root, "wf-9", JobLogName))
+	if err != nil {
+		t.Fatalf("read job log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one captured line, got %q", data)
+	}
+	for _, want := range []string{`msg="stage started"`, "service=orchestrator", "job_id=wf-9", "stage=text_to_image"} {
+		if !strings.Contains(lines[0], want) {
+			t.Fatalf("job log line %q missing %s", lines[0], want)
+		}
+	}
+}
+
+// remoteStore hides the file store's type, standing in for S3.
+type remoteStore struct {
+	artifacts.Store
+}
+
+func TestJobLogsKeepFileOpenAndUploadOnClose(t *testing.T) {
+	local, remoteRoot := t.TempDir(), t.TempDir()
+	files, err := artifacts.NewFileStore(remoteRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	EnableJobLogs("stage-sampler", local, remoteStore{files})
+	defer EnableJobLogs("", "", nil)
+
+	logger := slog.New(NewHandler(io.Discard, "text", slog.LevelInfo))
+	ctx := WithJob(context.Background(), "wf-3")
+	logger.InfoContext(ctx, "stage started")
+	logger.InfoContext(ctx, "stage completed")
+
+	sink := jobSink.Load()
+	sink.mu.Lock()
+	open := len(sink.files)
+	sink.mu.Unlock()
+	if open != 1 {
+		t.Fatalf("expected one open job log, got %d", open)
+	}
+	if _, err := files.Stat(ctx, "wf-3/job.stage-sampler.log"); err == nil {
+		t.Fatal("job log uploaded before the job ended")
+	}
+
+	CloseJobLog(ctx, "wf-3")
+	sink.mu.Lock()
+	open = len(sink.files)
+	sink.mu.Unlock()
+	if open != 0 {
+		t.Fatalf("expected the job log to be closed, %d still open", open)
+	}
+	body, _, err := files.Get(ctx, "wf-3/job.stage-sampler.log")
+	if err != nil {
+		t.Fatalf("uploaded job log: %v", err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `msg="stage completed"`) {
+		t.Fatalf("unexpected uploaded log %q", data)
+	}
+}
+
+func TestJobLogsCloseLeastRecentlyWrittenFile(t *testing.T) {
+	root := t.TempDir()
+	EnableJobLogs("orchestrator", root, nil)
+	defer EnableJobLogs("", "", nil)
+
+	logger := slog.New(NewHandler(io.Discard, "text", slog.LevelInfo))
+	for i := 0; i <= maxOpenJobLogs; i++ {
+		logger.InfoContext(WithJob(context.Background(), "wf-"+strconv.Itoa(i)), "queued")
+	}
+	logger.InfoContext(WithJob(context.Background(), "wf-0"), "dispatched")
+
+	sink := jobSink.Load()
+	sink.mu.Lock()
+	_, firstOpen := sink.files["wf-0"]
+	_, secondOpen := sink.files["wf-1"]
+	open := len(sink.files)
+	sink.mu.Unlock()
+	if open != maxOpenJobLogs || !firstOpen || secondOpen {
+		t.Fatalf("open=%d wf-0=%v wf-1=%v", open, firstOpen, secondOpen)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "wf-0", JobLogName))
+	if err != nil || strings.Count(string(data), "\n") != 2 {
+		t.Fatalf("reopened job log = %q, err %v", data, err)
+	}
+}
+
+func TestJobLogPathRejectsTraversal(t *testing.T) {
+	for _, id := range []string{"", ".", "..", "../etc", `a\b`, "a/b"} {
+		if _, err := JobLogPath("/artifacts", id); err == nil {
+			t.Fatalf("expected %q to be rejected", id)
+		}
+	}
+	path, err := JobLogPath("/artifacts", "wf-1")
+	if err != nil || path != filepath.Join("/artifacts", "wf-1", JobLogName) {
+		t.Fatalf("unexpected path %q, err %v", path, err)
+	}
+}
@@ -1,46 +1,23 @@
 package logging
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
-)
-
-type prefixedWriter struct {
-	service string
-	out     io.Writer
-}
-
-func (w *prefixedWriter) Write(p []byte) (int, error) {
-	timestamp := time.Now().UTC().Format(time.RFC3339)
-	prefix := fmt.Sprintf("%s %s ", timestamp, w.service)
-	lines := bytes.Split(p, []byte{'\n'})
 
-	var buf bytes.Buffer
-	for i, line := range lines {
-		if len(line) == 0 && i == len(lines)-1 {
-			break
-		}
-		buf.WriteString(prefix)
-		buf.Write(line)
-		buf.WriteByte('\n')
-	}
-
-	if buf.Len() == 0 {
-		return len(p), nil
-	}
-	if _, err := w.out.Write(buf.Bytes()); err != nil {
-		return 0, err
-	}
-	return len(p), nil
-}
+	"comfy-service-tests/internal/tracing"
+)
 
-// Setup configures the default logger to write to stdout and a log file.
-func Setup(serviceName, logDir string) (*os.File, error) {
+// Setup configures the default slog logger (and the standard log package, which
+// routes through it) to write to stdout and a rotating log file. LOG_FORMAT
+// selects "text" (default) or "json"; LOG_LEVEL selects debug, info, warn or
+// error; rotation is configured by RotateConfigFromEnv. The file is reopened on SIGHUP.
+func Setup(serviceName, logDir string) (*RotatingFile, error) {
 	if logDir == "" {
 		logDir = ".log"
 	}
@@ -48,15 +25,139 @@ func Setup(serviceName, logDir string) (*os.File, error) {
 		return nil, err
 	}
 	logPath := filepath.Join(logDir, serviceName+".log")
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	file, err := OpenRotatingFile(logPath, RotateConfigFromEnv())
 	if err != nil {
 		return nil, err
 	}
-	log.SetOutput(&prefixedWriter{
-		service: serviceName,
-		out:     io.MultiWriter(os.Stdout, file),
-	})
+	file.ReopenOnSignal()
+
+	handler := NewHandler(io.MultiWriter(os.Stdout, file), os.Getenv("LOG_FORMAT"), ParseLevel(os.Getenv("LOG_LEVEL")))
+	slog.SetDefault(slog.New(handler).With("service", serviceName))
 	log.SetFlags(0)
 	log.SetPrefix("")
 	return file, nil
 }
+
+// NewHandler builds a text or JSON handler that also emits fields carried on the context.
+func NewHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	var inner slog.Handler
+	if strings.EqualFold(format, "json") {
+		inner = slog.NewJSONHandler(w, opts)
+	} else {
+		inner = slog.NewTextHandler(w, opts)
+	}
+	return &contextHandler{Handler: inner}
+}
+
+// ParseLevel maps LOG_LEVEL values to slog levels, defaulting to info.
+func ParseLevel(value string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// AttemptMetadataKey carries the orchestrator's stage attempt number to stage services.
+const AttemptMetadataKey = "x-stage-attempt"
+
+type fieldsKey struct{}
+
+// With returns a context whose log records carry the given key/value pairs.
+func With(ctx context.Context, args ...any) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	record := slog.NewRecord(time.Time{}, slog.LevelInfo, "", 0)
+	record.Add(args...)
+
+	existing := fieldsFromContext(ctx)
+	fields := make([]slog.Attr, 0, len(existing)+record.NumAttrs())
+	fields = append(fields, existing...)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = replaceAttr(fields, attr)
+		return true
+	})
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// WithJob attaches job_id to log records written with ctx.
+func WithJob(ctx context.Context, jobID string) context.Context {
+	return With(ctx, "job_id", jobID)
+}
+
+// WithNode attaches node_id to log records written with ctx.
+func WithNode(ctx context.Context, nodeID int64) context.Context {
+	return With(ctx, "node_id", nodeID)
+}
+
+// WithStage attaches stage to log records written with ctx.
+func WithStage(ctx context.Context, stage string) context.Context {
+	return With(ctx, "stage", stage)
+}
+
+// WithAttempt attaches attempt to log records written with ctx.
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return With(ctx, "attempt", attempt)
+}
+
+// JobID returns the job_id carried on ctx, if any.
+func JobID(ctx context.Context) string {
+	for _, attr := range fieldsFromContext(ctx) {
+		if attr.Key == "job_id" {
+			return attr.Value.String()
+		}
+	}
+	return ""
+}
+
+func fieldsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	return fields
+}
+
+func replaceAttr(fields []slog.Attr, attr slog.Attr) []slog.Attr {
+	for i := range fields {
+		if fields[i].Key == attr.Key {
+			fields[i] = attr
+			return fields
+		}
+	}
+	return append(fields, attr)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields := fieldsFromContext(ctx); len(fields) > 0 {
+		record.AddAttrs(fields...)
+	}
+	if traceID := tracing.TraceIDFromContext(ctx); traceID != "" {
+		record.AddAttrs(slog.String("trace_id", traceID))
+	}
+	if sink := jobSink.Load(); sink != nil {
+		if jobID := JobID(ctx); jobID != "" {
+			sink.write(ctx, jobID, record.Clone())
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"comfy-service-tests/internal/tracing"
+)
+
+func TestJSONHandlerAttachesContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, "json", slog.LevelInfo)).With("service", "test")
+
+	ctx, span := tracing.Start(context.Background(), "test")
+	defer span.End()
+	ctx = WithAttempt(WithStage(WithNode(WithJob(ctx, "wf-1"), 7), "text_to_image"), 2)
+
+	logger.InfoContext(ctx, "stage started")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("decode record: %v", err)
+	}
+	expected := map[string]any{
+		"msg":      "stage started",
+		"service":  "test",
+		"job_id":   "wf-1",
+		"node_id":  7.0,
+		"stage":    "text_to_image",
+		"attempt":  2.0,
+		"trace_id": span.SpanContext().TraceID.String(),
+	}
+	for key, want := range expected {
+		if record[key] != want {
+			t.Fatalf("field %s = %v, want %v", key, record[key], want)
+		}
+	}
+}
+
+func TestWithReplacesExistingField(t *testing.T) {
+	ctx := WithJob(context.Background(), "wf-1")
+	child := WithJob(ctx, "wf-2")
+
+	if JobID(ctx) != "wf-1" {
+		t.Fatalf("parent context should be unchanged, got %s", JobID(ctx))
+	}
+	if JobID(child) != "wf-2" {
+		t.Fatalf("expected replaced job id, got %s", JobID(child))
+	}
+	if len(fieldsFromContext(child)) != 1 {
+		t.Fatalf("expected a single field, got %v", fieldsFromContext(child))
+	}
+}
+
+func TestTextHandlerRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, "text", ParseLevel("warn")))
+
+	logger.Info("hidden")
+	logger.Warn("shown", "key", "value")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatalf("info record should be filtered: %s", out)
+	}
+	if !strings.Contains(out, "msg=shown") || !strings.Contains(out, "key=value") {
+		t.Fatalf("unexpected text output: %s", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"DEBUG":   slog.LevelDebug,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"bogus":   slog.LevelInfo,
+	}
+	for input, want := range cases {
+		if got := ParseLevel(input); got != want {
+			t.Fatalf("ParseLevel(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
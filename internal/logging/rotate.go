@@ -0,0 +1,366 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotateConfig controls when the active log file is rotated and how many
+// rotated files are kept. Zero values disable the corresponding limit.
+type RotateConfig struct {
+	MaxBytes   int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+}
+
+// RotateConfigFromEnv reads LOG_MAX_SIZE_MB, LOG_MAX_AGE, LOG_MAX_BACKUPS and LOG_COMPRESS.
+func RotateConfigFromEnv() RotateConfig {
+	cfg := RotateConfig{
+		MaxBytes:   100 << 20,
+		MaxAge:     24 * time.Hour,
+		MaxBackups: 7,
+	}
+	if value := os.Getenv("LOG_MAX_SIZE_MB"); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			cfg.MaxBytes = parsed << 20
+		}
+	}
+	if value := os.Getenv("LOG_MAX_AGE"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			cfg.MaxAge = parsed
+		}
+	}
+	if value := os.Getenv("LOG_MAX_BACKUPS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			cfg.MaxBackups = parsed
+		}
+	}
+	if value := os.Getenv("LOG_COMPRESS"); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			cfg.Compress = parsed
+		}
+	}
+	return cfg
+}
+
+// RotatingFile is an append-only log file that rotates itself by size and age
+// and can be reopened after an external tool such as logrotate moves it.
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	background sync.WaitGroup
+	backupMu   sync.Mutex
+	stopSignal chan struct{}
+}
+
+// OpenRotatingFile opens (or creates) path for appending.
+func OpenRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, cfg: cfg, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	if f.size > 0 {
+		f.openedAt = startedAt(f.path, info)
+	}
+	return nil
+}
+
+// startedAt estimates when an existing log file was begun, so MaxAge counts
+// from its first record rather than from this process opening it; otherwise
+// restarts more frequent than MaxAge would postpone age rotation forever.
+// Files whose first line carries no slog timestamp fall back to their mtime.
+func startedAt(path string, info os.FileInfo) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(io.LimitReader(file, 4096)).ReadString('\n')
+	if when, ok := recordTime(line); ok {
+		return when
+	}
+	return info.ModTime()
+}
+
+// recordTime parses the leading time field of a slog text or JSON record.
+func recordTime(line string) (time.Time, bool) {
+	var value string
+	switch {
+	case strings.HasPrefix(line, "time="):
+		value, _, _ = strings.Cut(strings.TrimPrefix(line, "time="), " ")
+	case strings.HasPrefix(line, `{"time":"`):
+		value, _, _ = strings.Cut(strings.TrimPrefix(line, `{"time":"`), `"`)
+	default:
+		return time.Time{}, false
+	}
+	when, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	return when, err == nil
+}
+
+// Name returns the path of the active log file.
+func (f *RotatingFile) Name() string {
+	return f.path
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(incoming int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.cfg.MaxBytes > 0 && f.size+incoming > f.cfg.MaxBytes {
+		return true
+	}
+	if f.cfg.MaxAge > 0 && f.now().Sub(f.openedAt) >= f.cfg.MaxAge {
+		return true
+	}
+	return false
+}
+
+// Rotate forces a rotation regardless of size or age.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+// rotate moves the active file aside and opens a fresh one; callers hold f.mu.
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+
+	backup := f.path + "." + f.now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.background.Add(1)
+	go func() {
+		defer f.background.Done()
+		f.finishBackup(backup)
+	}()
+	return nil
+}
+
+func (f *RotatingFile) finishBackup(backup string) {
+	f.backupMu.Lock()
+	defer f.backupMu.Unlock()
+	if f.cfg.Compress {
+		if err := gzipFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotation: compress %s: %v\n", backup, err)
+		}
+	}
+	if err := f.prune(); err != nil {
+		fmt.Fprintf(os.Stderr, "log rotation: prune %s: %v\n", f.path, err)
+	}
+}
+
+// prune removes the oldest backups beyond MaxBackups.
+func (f *RotatingFile) prune() error {
+	if f.cfg.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) <= f.cfg.MaxBackups {
+		return nil
+	}
+	for _, old := range backups[:len(backups)-f.cfg.MaxBackups] {
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backups lists rotated files, oldest first.
+func (f *RotatingFile) Backups() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	prefix := f.path + "."
+	backups := matches[:0]
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	return backups, nil
+}
+
+// Reopen closes and reopens the log path, for use after logrotate renames it.
+// Reopening the same file keeps its age; a replacement file starts fresh.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	var previous os.FileInfo
+	if f.file != nil {
+		previous, _ = f.file.Stat()
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	openedAt := f.openedAt
+	if err := f.open(); err != nil {
+		return err
+	}
+	if current, err := f.file.Stat(); err == nil && previous != nil && os.SameFile(previous, current) {
+		f.openedAt = openedAt
+	}
+	return nil
+}
+
+// ReopenOnSignal reopens the file whenever one of sigs (SIGHUP by default) arrives.
+func (f *RotatingFile) ReopenOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	f.mu.Lock()
+	f.stopSignal = make(chan struct{})
+	stop := f.stopSignal
+	f.mu.Unlock()
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ch:
+				if err := f.Reopen(); err != nil {
+					slog.Error("log reopen failed", "path", f.path, "err", err)
+					continue
+				}
+				slog.Info("log file reopened", "path", f.path)
+			}
+		}
+	}()
+}
+
+// Close stops signal handling, waits for pending compression and closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.stopSignal != nil {
+		close(f.stopSignal)
+		f.stopSignal = nil
+	}
+	file := f.file
+	f.file = nil
+	f.closed = true
+	f.mu.Unlock()
+
+	f.background.Wait()
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,212 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func openTestFile(t *testing.T, cfg RotateConfig) (*RotatingFile, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	path := filepath.Join(t.TempDir(), "svc.log")
+	f := &RotatingFile{path: path, cfg: cfg, now: clock.Now}
+	if err := f.open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f, clock
+}
+
+func writeLine(t *testing.T, f *RotatingFile, clock *fakeClock, line string) {
+	t.Helper()
+	clock.Advance(time.Millisecond)
+	if _, err := f.Write([]byte(line + "\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestRotatingFileRotatesBySizeAndPrunes(t *testing.T) {
+	f, clock := openTestFile(t, RotateConfig{MaxBytes: 10, MaxBackups: 2})
+
+	for _, line := range []string{"first-01", "second-2", "third-03", "fourth-4"} {
+		writeLine(t, f, clock, line)
+	}
+	f.background.Wait()
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatalf("backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 retained backups, got %v", backups)
+	}
+	newest, _ := os.ReadFile(backups[1])
+	if string(newest) != "third-03\n" {
+		t.Fatalf("unexpected newest backup content: %q", newest)
+	}
+	active, _ := os.ReadFile(f.Name())
+	if string(active) != "fourth-4\n" {
+		t.Fatalf("unexpected active content: %q", active)
+	}
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	f, clock := openTestFile(t, RotateConfig{MaxAge: time.Hour})
+
+	writeLine(t, f, clock, "before")
+	writeLine(t, f, clock, "still-fresh")
+	clock.Advance(time.Hour)
+	writeLine(t, f, clock, "after")
+	f.background.Wait()
+
+	backups, _ := f.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	old, _ := os.ReadFile(backups[0])
+	if string(old) != "before\nstill-fresh\n" {
+		t.Fatalf("unexpected backup content: %q", old)
+	}
+}
+
+func TestRotatingFileAgesExistingFileFromFirstRecord(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	path := filepath.Join(t.TempDir(), "svc.log")
+	old := "time=2026-01-01T00:00:00.000Z level=INFO msg=\"from a previous run\"\n"
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatalf("seed log: %v", err)
+	}
+
+	// A restarted service appends to the file it left behind.
+	f := &RotatingFile{path: path, cfg: RotateConfig{MaxAge: 24 * time.Hour}, now: clock.Now}
+	if err := f.open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	writeLine(t, f, clock, "after restart")
+	f.background.Wait()
+
+	backups, _ := f.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected the stale file to rotate, got %v", backups)
+	}
+	if content, _ := os.ReadFile(backups[0]); string(content) != old {
+		t.Fatalf("unexpected backup content: %q", content)
+	}
+}
+
+func TestRotatingFileReopenKeepsAge(t *testing.T) {
+	f, clock := openTestFile(t, RotateConfig{MaxAge: time.Hour})
+
+	writeLine(t, f, clock, "before")
+	for i := 0; i < 3; i++ {
+		clock.Advance(30 * time.Minute)
+		if err := f.Reopen(); err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+	}
+	writeLine(t, f, clock, "after")
+	f.background.Wait()
+
+	backups, _ := f.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected rotation despite reopens, got %v", backups)
+	}
+}
+
+func TestRotatingFileCompressesBackups(t *testing.T) {
+	f, clock := openTestFile(t, RotateConfig{Compress: true, MaxBackups: 3})
+
+	writeLine(t, f, clock, "compress me")
+	if err := f.Rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	f.background.Wait()
+
+	backups, _ := f.Backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], ".gz") {
+		t.Fatalf("expected a gzipped backup, got %v", backups)
+	}
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	content, _ := io.ReadAll(zr)
+	if string(content) != "compress me\n" {
+		t.Fatalf("unexpected compressed content: %q", content)
+	}
+}
+
+func TestRotatingFileReopenOnSignal(t *testing.T) {
+	f, clock := openTestFile(t, RotateConfig{})
+	f.ReopenOnSignal(syscall.SIGUSR1)
+
+	writeLine(t, f, clock, "before move")
+	moved := f.Name() + ".1"
+	if err := os.Rename(f.Name(), moved); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(f.Name()); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("log file was not reopened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	writeLine(t, f, clock, "after move")
+
+	active, _ := os.ReadFile(f.Name())
+	if string(active) != "after move\n" {
+		t.Fatalf("unexpected reopened content: %q", active)
+	}
+	old, _ := os.ReadFile(moved)
+	if string(old) != "before move\n" {
+		t.Fatalf("unexpected moved content: %q", old)
+	}
+}
+
+func TestRotatingFileRejectsWritesAfterClose(t *testing.T) {
+	f, _ := openTestFile(t, RotateConfig{})
+	if err := f.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Fatalf("expected error writing to closed file")
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcServerRequests = Default.NewCounter("comfy_grpc_server_requests_total", "gRPC requests handled, by method and status code.", "method", "code")
+	grpcServerDuration = Default.NewHistogram("comfy_grpc_server_request_duration_seconds", "gRPC server handling latency.", DefaultBuckets, "method")
+	grpcClientRequests = Default.NewCounter("comfy_grpc_client_requests_total", "gRPC requests issued, by method and status code.", "method", "code")
+	grpcClientDuration = Default.NewHistogram("comfy_grpc_client_request_duration_seconds", "gRPC client call latency.", DefaultBuckets, "method")
+)
+
+// UnaryServerInterceptor counts and times unary RPCs.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		grpcServerDuration.Observe(time.Since(start).Seconds(), info.FullMethod)
+		grpcServerRequests.Inc(info.FullMethod, status.Code(err).String())
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor counts and times streaming RPCs for their whole lifetime.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		grpcServerDuration.Observe(time.Since(start).Seconds(), info.FullMethod)
+		grpcServerRequests.Inc(info.FullMethod, status.Code(err).String())
+		return err
+	}
+}
+
+// UnaryClientInterceptor counts and times outgoing unary RPCs.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		grpcClientDuration.Observe(time.Since(start).Seconds(), method)
+		grpcClientRequests.Inc(method, status.Code(err).String())
+		return err
+	}
+}
+
+// StreamClientInterceptor counts outgoing streaming RPCs when they are opened.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		grpcClientDuration.Observe(time.Since(start).Seconds(), method)
+		grpcClientRequests.Inc(method, status.Code(err).String())
+		return stream, err
+	}
+}
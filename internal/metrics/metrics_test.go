@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape fetches the handler output and parses sample lines into name{labels} -> value.
+func scrape(t *testing.T, handler http.Handler) (map[string]float64, map[string]string) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	samples := make(map[string]float64)
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			types[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if idx < 0 {
+			t.Fatalf("malformed sample line: %q", line)
+		}
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			t.Fatalf("malformed value in %q: %v", line, err)
+		}
+		samples[line[:idx]] = value
+	}
+	return samples, types
+}
+
+func TestRegistryTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounter("test_requests_total", "Requests.", "code")
+	requests.Inc("200")
+	requests.Add(2, "500")
+	depth := reg.NewGauge("test_depth", "Depth.")
+	depth.Set(3)
+	reg.NewGaugeFunc("test_jobs", "Jobs.", "state", func() map[string]float64 {
+		return map[string]float64{"queued": 1, "running": 2}
+	})
+	latency := reg.NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.1}, "node")
+	latency.Observe(0.05, "a")
+	latency.Observe(0.5, "a")
+	latency.Observe(5, "a")
+
+	samples, types := scrape(t, reg.Handler())
+
+	expected := map[string]float64{
+		`test_requests_total{code="200"}`:                 1,
+		`test_requests_total{code="500"}`:                 2,
+		`test_depth`:                                      3,
+		`test_jobs{state="queued"}`:                       1,
+		`test_jobs{state="running"}`:                      2,
+		`test_latency_seconds_bucket{node="a",le="0.1"}`:  1,
+		`test_latency_seconds_bucket{node="a",le="1"}`:    2,
+		`test_latency_seconds_bucket{node="a",le="+Inf"}`: 3,
+		`test_latency_seconds_sum{node="a"}`:              5.55,
+		`test_latency_seconds_count{node="a"}`:            3,
+	}
+	for key, want := range expected {
+		got, ok := samples[key]
+		if !ok {
+			t.Fatalf("missing sample %s", key)
+		}
+		if got != want {
+			t.Fatalf("sample %s = %v, want %v", key, got, want)
+		}
+	}
+	if types["test_latency_seconds"] != "histogram" || types["test_requests_total"] != "counter" || types["test_jobs"] != "gauge" {
+		t.Fatalf("unexpected types: %v", types)
+	}
+}
+
+func TestRegistryReturnsExistingFamily(t *testing.T) {
+	reg := NewRegistry()
+	first := reg.NewCounter("test_total", "Total.")
+	second := reg.NewCounter("test_total", "Total.")
+	first.Inc()
+	if second.Value() != 1 {
+		t.Fatalf("expected shared counter, got %v", second.Value())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic on type mismatch")
+		}
+	}()
+	reg.NewGauge("test_total", "Total.")
+}
+
+func TestLabelEscaping(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("test_escape_total", "Escape.", "path").Inc("a\"b\\c\nd")
+
+	samples, _ := scrape(t, reg.Handler())
+	if samples[`test_escape_total{path="a\"b\\c\nd"}`] != 1 {
+		t.Fatalf("expected escaped label, got %v", samples)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler(func(*http.Request) string { return "/v1/test" }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	before := httpRequests.Value(http.MethodGet, "/v1/test", "418")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/test", nil))
+
+	if got := httpRequests.Value(http.MethodGet, "/v1/test", "418"); got != before+1 {
+		t.Fatalf("expected request count to increase, got %v", got)
+	}
+	if httpDuration.Count(http.MethodGet, "/v1/test") == 0 {
+		t.Fatalf("expected latency observation")
+	}
+}
@@ -0,0 +1,132 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/logging"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// InterruptedFile is stored under <job-id>/ in the artifact store for each
+	// job a shutdown cut short. It holds the original request for resubmission.
+	InterruptedFile = "interrupted.json"
+
+	interruptedMessage = "interrupted by orchestrator shutdown"
+)
+
+// interruptedJob is the InterruptedFile layout.
+type interruptedJob struct {
+	ID            string          `json:"id"`
+	SubmittedBy   string          `json:"submitted_by,omitempty"`
+	SubmittedAt   time.Time       `json:"submitted_at"`
+	InterruptedAt time.Time       `json:"interrupted_at"`
+	State         string          `json:"state"`
+	Message       string          `json:"message,omitempty"`
+	Request       json.RawMessage `json:"request"`
+}
+
+// Drain stops accepting jobs and waits for running ones to finish. If ctx
+// ends first it cancels the remaining jobs, marks them failed and records
+// each under InterruptedFile, then returns an error naming how many were cut
+// short. Status calls keep working throughout so streams see final states.
+func (s *Server) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	h := s.health
+	s.mu.Unlock()
+	if h != nil {
+		h.Shutdown()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// Snapshot before cancelling: the jobs release their requests as they end.
+	interruptedAt := time.Now()
+	var pending []interruptedJob
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if job.request == nil || job.State == "completed" || job.State == "failed" {
+			continue
+		}
+		record := interruptedJob{
+			ID:            job.ID,
+			SubmittedBy:   job.SubmittedBy,
+			SubmittedAt:   job.SubmittedAt,
+			InterruptedAt: interruptedAt,
+			State:         job.State,
+			Message:       job.Message,
+		}
+		if raw, err := protojson.Marshal(job.request); err == nil {
+			record.Request = raw
+		}
+		pending = append(pending, record)
+	}
+	s.mu.Unlock()
+
+	s.cancelRuns()
+	<-done
+
+	interrupted := 0
+	for _, record := range pending {
+		jobCtx := logging.WithJob(context.Background(), record.ID)
+		s.mu.Lock()
+		job := s.jobs[record.ID]
+		// A job may still have completed between the snapshot and the cancel.
+		finished := job == nil || job.State == "completed"
+		if !finished {
+			job.State = "failed"
+			job.Message = interruptedMessage
+			job.UpdatedAt = time.Now()
+			job.CompletedAt = job.UpdatedAt
+		}
+		s.mu.Unlock()
+		if finished {
+			continue
+		}
+		interrupted++
+		if err := s.recordInterrupted(jobCtx, record); err != nil {
+			slog.ErrorContext(jobCtx, "failed to record interrupted job", "err", err)
+			continue
+		}
+		slog.WarnContext(jobCtx, "job interrupted by shutdown", "state", record.State)
+	}
+	return fmt.Errorf("drain: %d job(s) interrupted: %w", interrupted, ctx.Err())
+}
+
+func (s *Server) recordInterrupted(ctx context.Context, record interruptedJob) error {
+	store := s.artifactStore()
+	if store == nil {
+		return nil
+	}
+	payload, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = artifacts.PutBytes(ctx, store, record.ID+"/"+InterruptedFile, payload, "application/json")
+	return err
+}
+
+// releaseRequest drops the request kept for Drain once a job has ended.
+func (s *Server) releaseRequest(jobID string) {
+	s.mu.Lock()
+	if job := s.jobs[jobID]; job != nil {
+		job.request = nil
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func drainTestRequest() *orchestratorv1.ExecuteWorkflowRequest {
+	return &orchestratorv1.ExecuteWorkflowRequest{
+		Graph:    &orchestratorv1.WorkflowGraph{WorkflowJson: `{"nodes":[]}`},
+		Metadata: map[string]string{MetadataSubmittedBy: "ci"},
+	}
+}
+
+func TestDrainWaitsForRunningJobs(t *testing.T) {
+	stage := &blockingStageClient{
+		fakeStageClient: fakeStageClient{resp: &orchestratorv1.StageResult{
+			Status:     "completed",
+			OutputRefs: map[string]*orchestratorv1.TensorRef{"image": {Uri: "artifact://job/output.png"}},
+		}},
+		release: make(chan struct{}),
+	}
+	server := NewServer(stage, "", time.Minute, 0, 0)
+	resp, err := server.ExecuteWorkflow(context.Background(), drainTestRequest())
+	if err != nil {
+		t.Fatalf("execute workflow: %v", err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- server.Drain(context.Background()) }()
+
+	// Draining refuses new work before the running job finishes.
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := server.ExecuteWorkflow(context.Background(), drainTestRequest())
+		if status.Code(err) == codes.Unavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected Unavailable while draining, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned before the job finished: %v", err)
+	default:
+	}
+
+	close(stage.release)
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("drain: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain did not return after the job finished")
+	}
+	if job := server.getJob(resp.WorkflowId); job.State != "completed" {
+		t.Fatalf("expected completed job, got %s (%s)", job.State, job.Message)
+	}
+}
+
+func TestDrainTimeoutRecordsInterruptedJobs(t *testing.T) {
+	stage := &blockingStageClient{
+		fakeStageClient: fakeStageClient{resp: &orchestratorv1.StageResult{Status: "completed"}},
+		release:         make(chan struct{}),
+	}
+	defer close(stage.release)
+	root := t.TempDir()
+	server := NewServer(stage, root, time.Minute, 0, 0)
+	resp, err := server.ExecuteWorkflow(context.Background(), drainTestRequest())
+	if err != nil {
+		t.Fatalf("execute workflow: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); err == nil {
+		t.Fatal("expected drain to report the interrupted job")
+	}
+
+	job := server.getJob(resp.WorkflowId)
+	if job.State != "failed" || job.Message != interruptedMessage {
+		t.Fatalf("expected interrupted job, got %s (%s)", job.State, job.Message)
+	}
+	payload, err := os.ReadFile(filepath.Join(root, resp.WorkflowId, InterruptedFile))
+	if err != nil {
+		t.Fatalf("read interrupted record: %v", err)
+	}
+	var record struct {
+		ID          string          `json:"id"`
+		SubmittedBy string          `json:"submitted_by"`
+		Request     json.RawMessage `json:"request"`
+	}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		t.Fatalf("decode interrupted record: %v", err)
+	}
+	if record.ID != resp.WorkflowId || record.SubmittedBy != "ci" || len(record.Request) == 0 {
+		t.Fatalf("unexpected interrupted record %s", payload)
+	}
+}
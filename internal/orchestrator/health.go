@@ -0,0 +1,126 @@
+package orchestrator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// StageCheck probes a stage backend; nil means it is serving.
+type StageCheck func(ctx context.Context) error
+
+// NewStageCheck checks the stage service through grpc.health.v1, falling
+// back to the StageRunner Health RPC for samplers without the standard service.
+func NewStageCheck(healthClient healthpb.HealthClient, stage orchestratorv1.StageRunnerClient) StageCheck {
+	service := orchestratorv1.StageRunner_ServiceDesc.ServiceName
+	return func(ctx context.Context) error {
+		resp, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if status.Code(err) == codes.Unimplemented {
+			_, err = stage.Health(ctx, &orchestratorv1.HealthRequest{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return status.Errorf(codes.Unavailable, "stage reports %s", resp.GetStatus())
+		}
+		return nil
+	}
+}
+
+// SetHealth attaches the gRPC health server whose status follows the stage
+// backend: SERVING while it is available, NOT_SERVING otherwise and after a
+// drain starts.
+func (s *Server) SetHealth(h *health.Server) {
+	s.mu.Lock()
+	s.health = h
+	s.mu.Unlock()
+	s.publishHealth(s.StageAvailable())
+}
+
+// StageAvailable reports whether the stage backend passed its last checks.
+func (s *Server) StageAvailable() bool {
+	return s.stageAvailable.Load()
+}
+
+func (s *Server) publishHealth(available bool) {
+	s.mu.Lock()
+	h, draining := s.health, s.draining
+	s.mu.Unlock()
+	if h == nil || draining {
+		return
+	}
+	state := healthpb.HealthCheckResponse_NOT_SERVING
+	if available {
+		state = healthpb.HealthCheckResponse_SERVING
+	}
+	h.SetServingStatus("", state)
+	h.SetServingStatus(orchestratorv1.Orchestrator_ServiceDesc.ServiceName, state)
+}
+
+// MonitorStage runs check every interval until ctx ends. The backend is
+// marked unavailable after threshold consecutive failures, which makes
+// ExecuteWorkflow refuse new jobs, and available again on the next success.
+// The first check runs immediately and settles the state either way. Only
+// the first failure of a streak is logged; the state changes log the rest.
+func (s *Server) MonitorStage(ctx context.Context, check StageCheck, interval, timeout time.Duration, threshold int) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if threshold < 1 {
+		threshold = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for first := true; ; first = false {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures = 0
+			s.setStageAvailable(true, nil)
+		} else {
+			failures++
+			if failures == 1 {
+				slog.Warn("stage health check failed", "err", err, "threshold", threshold)
+			}
+			if first || failures >= threshold {
+				s.setStageAvailable(false, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) setStageAvailable(available bool, err error) {
+	if s.stageAvailable.Swap(available) == available {
+		return
+	}
+	if available {
+		slog.Info("stage backend available")
+	} else {
+		slog.Error("stage backend unavailable", "err", err)
+	}
+	s.publishHealth(available)
+}
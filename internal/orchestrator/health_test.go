@@ -0,0 +1,172 @@
+package orchestrator
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func servingStatus(t *testing.T, h *health.Server) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := h.Check(context.Background(), &healthpb.HealthCheckRequest{Service: orchestratorv1.Orchestrator_ServiceDesc.ServiceName})
+	if err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	return resp.GetStatus()
+}
+
+func TestMonitorStageMarksBackendUnavailable(t *testing.T) {
+	server := NewServer(&fakeStageClient{}, "", time.Minute, 0, 0)
+	h := health.NewServer()
+	server.SetHealth(h)
+
+	// Each check takes its result from results, so the test steps the monitor.
+	results := make(chan error)
+	check := func(ctx context.Context) error {
+		select {
+		case err := <-results:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.MonitorStage(ctx, check, time.Millisecond, time.Minute, 2)
+
+	down := status.Error(codes.Unavailable, "connection refused")
+	results <- down
+	waitFor(t, time.Second, func() bool { return !server.StageAvailable() })
+	if got := servingStatus(t, h); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected NOT_SERVING after a failed first check, got %s", got)
+	}
+	_, err := server.ExecuteWorkflow(context.Background(), &orchestratorv1.ExecuteWorkflowRequest{})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable while the stage is down, got %v", err)
+	}
+
+	results <- nil
+	waitFor(t, time.Second, server.StageAvailable)
+	if got := servingStatus(t, h); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING after recovery, got %s", got)
+	}
+
+	// Below the threshold a single failure does not flip the state.
+	results <- down
+	results <- nil
+	if !server.StageAvailable() {
+		t.Fatal("expected one failure under the threshold to be tolerated")
+	}
+	results <- down
+	results <- down
+	waitFor(t, time.Second, func() bool { return !server.StageAvailable() })
+}
+
+func TestDrainMarksHealthNotServing(t *testing.T) {
+	server := NewServer(&fakeStageClient{}, "", time.Minute, 0, 0)
+	h := health.NewServer()
+	server.SetHealth(h)
+	if got := servingStatus(t, h); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING, got %s", got)
+	}
+	if err := server.Drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if got := servingStatus(t, h); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected NOT_SERVING while draining, got %s", got)
+	}
+}
+
+type fakeHealthClient struct {
+	resp *healthpb.HealthCheckResponse
+	err  error
+}
+
+func (f *fakeHealthClient) Check(ctx context.Context, _ *healthpb.HealthCheckRequest, _ ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	return f.resp, f.err
+}
+
+func (f *fakeHealthClient) Watch(ctx context.Context, _ *healthpb.HealthCheckRequest, _ ...grpc.CallOption) (healthpb.Health_WatchClient, error) {
+	return nil, status.Error(codes.Unimplemented, "watch")
+}
+
+func TestStageCheckUsesStandardHealthWithLegacyFallback(t *testing.T) {
+	stage := &fakeStageClient{}
+	for name, tc := range map[string]struct {
+		client *fakeHealthClient
+		ok     bool
+	}{
+		"serving":     {client: &fakeHealthClient{resp: &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}}, ok: true},
+		"not serving": {client: &fakeHealthClient{resp: &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}}},
+		"unreachable": {client: &fakeHealthClient{err: status.Error(codes.Unavailable, "down")}},
+		"legacy":      {client: &fakeHealthClient{err: status.Error(codes.Unimplemented, "unknown service")}, ok: true},
+	} {
+		err := NewStageCheck(tc.client, stage)(context.Background())
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: got %v", name, err)
+		}
+	}
+}
+
+// countingHandler counts records with a given message.
+type countingHandler struct {
+	msg   string
+	count *atomic.Int32
+}
+
+func (h countingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h countingHandler) Handle(_ context.Context, record slog.Record) error {
+	if record.Message == h.msg {
+		h.count.Add(1)
+	}
+	return nil
+}
+func (h countingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h countingHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestMonitorStageLogsOncePerFailureStreak(t *testing.T) {
+	var logged atomic.Int32
+	previous := slog.Default()
+	slog.SetDefault(slog.New(countingHandler{msg: "stage health check failed", count: &logged}))
+	defer slog.SetDefault(previous)
+
+	server := NewServer(&fakeStageClient{}, "", time.Minute, 0, 0)
+	results := make(chan error)
+	checked := make(chan struct{})
+	check := func(ctx context.Context) error {
+		select {
+		case err := <-results:
+			checked <- struct{}{}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.MonitorStage(ctx, check, time.Millisecond, time.Minute, 2)
+
+	step := func(err error) {
+		results <- err
+		<-checked
+	}
+	down := status.Error(codes.Unavailable, "connection refused")
+	for i := 0; i < 5; i++ {
+		step(down)
+	}
+	step(nil)
+	step(down)
+	step(nil)
+	if got := logged.Load(); got != 2 {
+		t.Fatalf("expected one warning per failure streak, got %d", got)
+	}
+}
@@ -0,0 +1,84 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"comfy-service-tests/internal/artifacts"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"comfy-service-tests/internal/tracing"
+)
+
+// SetArtifactStore replaces the store used to verify artifact digests and to
+// record interrupted jobs. By default the server uses a file store at its
+// artifacts root.
+func (s *Server) SetArtifactStore(store artifacts.Store) {
+	s.mu.Lock()
+	s.store = store
+	s.mu.Unlock()
+}
+
+func (s *Server) artifactStore() artifacts.Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
+}
+
+// verifyRefs validates every ref's URI and metadata, then re-hashes refs that
+// carry a digest. Refs that escape the artifact store fail the job; refs
+// without a digest (older stage services) are not read back.
+func (s *Server) verifyRefs(ctx context.Context, refs map[string]*orchestratorv1.TensorRef) error {
+	store := s.artifactStore()
+	if store == nil || len(refs) == 0 {
+		return nil
+	}
+	resolver := artifacts.NewResolver(store)
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ref := refs[name]
+		refStore, key, err := resolver.ResolveRef(ref)
+		if err != nil {
+			artifactVerifyFailures.Inc()
+			return fmt.Errorf("artifact %q rejected: %w", name, err)
+		}
+		if ref.GetDigest() == "" {
+			slog.DebugContext(ctx, "artifact has no digest, skipping hash check", "ref", name, "uri", ref.GetUri())
+			continue
+		}
+
+		verifyCtx, span := tracing.Start(ctx, "artifact.verify")
+		span.SetAttribute("artifact.uri", ref.GetUri())
+		obj, err := artifacts.Verify(verifyCtx, refStore, key, ref.GetDigest())
+		if err == nil && ref.GetSizeBytes() > 0 && obj.Size != ref.GetSizeBytes() {
+			err = fmt.Errorf("%w: %s has %d bytes, want %d", artifacts.ErrDigestMismatch, key, obj.Size, ref.GetSizeBytes())
+		}
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			artifactVerifyFailures.Inc()
+			return fmt.Errorf("artifact %q failed integrity check: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func integrityMessage(err error) string {
+	if errors.Is(err, artifacts.ErrDigestMismatch) {
+		return "artifact corrupted: " + err.Error()
+	}
+	if errors.Is(err, artifacts.ErrNotFound) {
+		return "artifact missing: " + err.Error()
+	}
+	if errors.Is(err, artifacts.ErrInvalidRef) || errors.Is(err, artifacts.ErrOutsideRoot) {
+		return "invalid artifact ref: " + err.Error()
+	}
+	return err.Error()
+}
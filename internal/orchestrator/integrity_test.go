@@ -0,0 +1,62 @@
+package orchestrator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"comfy-service-tests/internal/artifacts"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+)
+
+func TestRunJobVerifiesOutputDigest(t *testing.T) {
+	root := t.TempDir()
+	store, err := artifacts.NewFileStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	obj, err := artifacts.PutBytes(context.Background(), store, "job-5/output.png", []byte("rendered"), "image/png")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	ref := &orchestratorv1.TensorRef{Uri: store.URI("job-5/output.png"), Digest: obj.Digest, SizeBytes: obj.Size}
+	fake := &fakeStageClient{resp: &orchestratorv1.StageResult{
+		Status:     "completed",
+		OutputRefs: map[string]*orchestratorv1.TensorRef{"image": ref},
+	}}
+	server := NewServer(fake, root, time.Second, 0, 0)
+
+	server.jobs["job-5"] = &Job{ID: "job-5", State: "queued"}
+	server.runJob("job-5", &orchestratorv1.ExecuteWorkflowRequest{})
+	if state := server.jobs["job-5"].State; state != "completed" {
+		t.Fatalf("expected intact artifact to complete, got %s: %s", state, server.jobs["job-5"].Message)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "job-5", "output.png"), []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("corrupt artifact: %v", err)
+	}
+	server.jobs["job-6"] = &Job{ID: "job-6", State: "queued"}
+	server.runJob("job-6", &orchestratorv1.ExecuteWorkflowRequest{})
+	job := server.jobs["job-6"]
+	if job.State != "failed" || !strings.HasPrefix(job.Message, "artifact corrupted") {
+		t.Fatalf("expected corrupted artifact to fail the job, got %s: %s", job.State, job.Message)
+	}
+}
+
+func TestRunJobRejectsRefOutsideArtifactsRoot(t *testing.T) {
+	fake := &fakeStageClient{resp: &orchestratorv1.StageResult{
+		Status:     "completed",
+		OutputRefs: map[string]*orchestratorv1.TensorRef{"image": {Uri: "file:///etc/passwd"}},
+	}}
+	server := NewServer(fake, t.TempDir(), time.Second, 0, 0)
+	server.jobs["job-7"] = &Job{ID: "job-7", State: "queued"}
+
+	server.runJob("job-7", &orchestratorv1.ExecuteWorkflowRequest{})
+	job := server.jobs["job-7"]
+	if job.State != "failed" || !strings.HasPrefix(job.Message, "invalid artifact ref") {
+		t.Fatalf("expected escaping ref to fail the job, got %s: %s", job.State, job.Message)
+	}
+}
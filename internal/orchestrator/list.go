@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"context"
+	"sort"
+
+	"comfy-service-tests/internal/jobid"
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// SetInstance changes the prefix of newly generated workflow ids, so jobs from
+// several orchestrator replicas stay distinguishable.
+func (s *Server) SetInstance(instance string) {
+	s.mu.Lock()
+	s.ids = jobid.NewGenerator(instance)
+	s.mu.Unlock()
+}
+
+func (s *Server) newJobID() string {
+	s.mu.Lock()
+	ids := s.ids
+	s.mu.Unlock()
+	return ids.New()
+}
+
+// ListWorkflows returns jobs newest first. Ordering comes from the
+// time-sortable ids alone, so pages are stable while new jobs arrive.
+func (s *Server) ListWorkflows(ctx context.Context, req *orchestratorv1.ListWorkflowsRequest) (*orchestratorv1.ListWorkflowsResponse, error) {
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if before := req.GetBefore(); before != "" {
+		if err := jobid.Validate(before); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	s.mu.Lock()
+	summaries := make([]*orchestratorv1.WorkflowSummary, 0, len(s.jobs))
+	for id, job := range s.jobs {
+		if req.GetBefore() != "" && jobid.Compare(id, req.GetBefore()) >= 0 {
+			continue
+		}
+		if req.GetState() != "" && job.State != req.GetState() {
+			continue
+		}
+		summaries = append(summaries, &orchestratorv1.WorkflowSummary{
+			WorkflowId:        id,
+			State:             job.State,
+			Message:           job.Message,
+			SubmittedAtUnixMs: unixMillis(job.SubmittedAt),
+			CompletedAtUnixMs: unixMillis(job.CompletedAt),
+			Output:            job.Output,
+			SubmittedBy:       job.SubmittedBy,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return jobid.Compare(summaries[i].WorkflowId, summaries[j].WorkflowId) > 0
+	})
+	resp := &orchestratorv1.ListWorkflowsResponse{}
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+		resp.NextBefore = summaries[limit-1].WorkflowId
+	}
+	resp.Workflows = summaries
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+package orchestrator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+)
+
+func TestListWorkflowsNewestFirstWithPaging(t *testing.T) {
+	server := NewServer(&fakeStageClient{}, "/artifacts", time.Second, 0, 0)
+	server.SetInstance("orch-a")
+
+	var ids []string
+	server.mu.Lock()
+	for i := 0; i < 5; i++ {
+		id := server.ids.New()
+		state := "completed"
+		if i%2 == 1 {
+			state = "failed"
+		}
+		server.jobs[id] = &Job{ID: id, State: state}
+		ids = append(ids, id)
+	}
+	server.mu.Unlock()
+	if !strings.HasPrefix(ids[0], "orcha-") {
+		t.Fatalf("expected instance prefix, got %q", ids[0])
+	}
+
+	ctx := context.Background()
+	page, err := server.ListWorkflows(ctx, &orchestratorv1.ListWorkflowsRequest{Limit: 3})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page.Workflows) != 3 || page.Workflows[0].WorkflowId != ids[4] || page.Workflows[2].WorkflowId != ids[2] {
+		t.Fatalf("unexpected first page %v", page.Workflows)
+	}
+	if page.NextBefore != ids[2] {
+		t.Fatalf("unexpected cursor %q", page.NextBefore)
+	}
+
+	page, err = server.ListWorkflows(ctx, &orchestratorv1.ListWorkflowsRequest{Limit: 3, Before: page.NextBefore})
+	if err != nil {
+		t.Fatalf("list second page: %v", err)
+	}
+	if len(page.Workflows) != 2 || page.Workflows[0].WorkflowId != ids[1] || page.NextBefore != "" {
+		t.Fatalf("unexpected second page %v next %q", page.Workflows, page.NextBefore)
+	}
+
+	failed, err := server.ListWorkflows(ctx, &orchestratorv1.ListWorkflowsRequest{State: "failed"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(failed.Workflows) != 2 || failed.Workflows[0].WorkflowId != ids[3] {
+		t.Fatalf("unexpected failed jobs %v", failed.Workflows)
+	}
+
+	if _, err := server.ListWorkflows(ctx, &orchestratorv1.ListWorkflowsRequest{Before: "../x"}); err == nil {
+		t.Fatalf("expected invalid cursor error")
+	}
+}
+
+func TestListWorkflowsReportsSubmitter(t *testing.T) {
+	server := NewServer(&fakeStageClient{}, "/artifacts", time.Second, 0, 0)
+	resp, err := server.ExecuteWorkflow(context.Background(), &orchestratorv1.ExecuteWorkflowRequest{
+		Graph:    &orchestratorv1.WorkflowGraph{WorkflowJson: `{"nodes":[]}`},
+		Metadata: map[string]string{MetadataSubmittedBy: "ci", MetadataAuthMethod: "api_key"},
+	})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	list, err := server.ListWorkflows(context.Background(), &orchestratorv1.ListWorkflowsRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list.Workflows) != 1 || list.Workflows[0].WorkflowId != resp.WorkflowId || list.Workflows[0].SubmittedBy != "ci" {
+		t.Fatalf("unexpected workflows %v", list.Workflows)
+	}
+}
@@ -0,0 +1,40 @@
+package orchestrator
+
+import (
+	"comfy-service-tests/internal/metrics"
+)
+
+var (
+	jobsSubmitted = metrics.Default.NewCounter("comfy_orchestrator_jobs_submitted_total", "Workflows accepted by ExecuteWorkflow.")
+	jobsRejected  = metrics.Default.NewCounter("comfy_orchestrator_jobs_rejected_total", "Workflows refused by ExecuteWorkflow, by reason.", "reason")
+	jobsFinished  = metrics.Default.NewCounter("comfy_orchestrator_jobs_finished_total", "Workflows that reached a terminal state.", "state")
+	stageDuration = metrics.Default.NewHistogram("comfy_orchestrator_stage_duration_seconds", "Stage latency including retries, by node type.", metrics.DefaultBuckets, "node_type", "status")
+	stageAttempts = metrics.Default.NewCounter("comfy_orchestrator_stage_attempts_total", "RunStage calls, by node type.", "node_type")
+	stageRetries  = metrics.Default.NewCounter("comfy_orchestrator_stage_retries_total", "RunStage calls retried after a retryable error, by node type.", "node_type")
+
+	artifactVerifyFailures = metrics.Default.NewCounter("comfy_orchestrator_artifact_verify_failures_total", "Stage artifacts whose digest or size did not match their ref.")
+)
+
+// RegisterMetrics exposes job gauges computed from the in-memory job table.
+func (s *Server) RegisterMetrics(reg *metrics.Registry) {
+	reg.NewGaugeFunc("comfy_orchestrator_jobs", "Jobs currently tracked, by state.", "state", s.jobCountsByState)
+	reg.NewGaugeFunc("comfy_orchestrator_queue_depth", "Jobs accepted but not yet dispatched to a stage.", "", func() map[string]float64 {
+		return map[string]float64{"": s.jobCountsByState()["queued"]}
+	})
+	reg.NewGaugeFunc("comfy_orchestrator_stage_available", "1 while the stage backend passes health checks, 0 otherwise.", "", func() map[string]float64 {
+		if s.StageAvailable() {
+			return map[string]float64{"": 1}
+		}
+		return map[string]float64{"": 0}
+	})
+}
+
+func (s *Server) jobCountsByState() map[string]float64 {
+	counts := map[string]float64{"queued": 0, "running": 0, "completed": 0, "failed": 0}
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		counts[job.State]++
+	}
+	s.mu.Unlock()
+	return counts
+}
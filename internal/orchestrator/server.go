@@ -4,25 +4,52 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"comfy-service-tests/internal/artifacts"
+	"comfy-service-tests/internal/jobid"
+	"comfy-service-tests/internal/logging"
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"comfy-service-tests/internal/tracing"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExecuteWorkflowRequest.Metadata keys set by the gateway. MaxActiveJobs is
+// the submitter's quota of queued and running jobs; 0 or unset means none.
+const (
+	MetadataSubmittedBy   = "submitted_by"
+	MetadataAuthMethod    = "auth_method"
+	MetadataMaxActiveJobs = "max_active_jobs"
 )
 
 type Job struct {
-	ID         string
-	State      string
-	Message    string
-	Progress   float64
-	OutputURI  string
-	UpdatedAt  time.Time
-	NodeStates map[int64]*orchestratorv1.NodeState
+	ID           string
+	SubmittedBy  string
+	State        string
+	Message      string
+	Progress     float64
+	OutputURI    string
+	Output       *orchestratorv1.TensorRef
+	UpdatedAt    time.Time
+	SubmittedAt  time.Time
+	DispatchedAt time.Time
+	CompletedAt  time.Time
+	Stages       []*StageTiming
+	NodeStates   map[int64]*orchestratorv1.NodeState
+
+	trace     tracing.SpanContext
+	queueSpan *tracing.Span
+	// request is kept while the job runs so a shutdown can record it.
+	request *orchestratorv1.ExecuteWorkflowRequest
 }
 
 type Server struct {
@@ -31,9 +58,22 @@ type Server struct {
 	jobs            map[string]*Job
 	stageClient     orchestratorv1.StageRunnerClient
 	artifactsRoot   string
+	store           artifacts.Store
+	ids             *jobid.Generator
 	stageTimeout    time.Duration
 	stageRetries    int
 	stageRetryDelay time.Duration
+
+	// draining refuses new jobs; inflight counts running runJob calls, whose
+	// stage calls are cancelled through runCtx when a drain times out.
+	draining   bool
+	inflight   sync.WaitGroup
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+
+	// stageAvailable is maintained by MonitorStage; health mirrors it.
+	stageAvailable atomic.Bool
+	health         *health.Server
 }
 
 func NewServer(stageClient orchestratorv1.StageRunnerClient, artifactsRoot string, stageTimeout time.Duration, stageRetries int, stageRetryDelay time.Duration) *Server {
@@ -46,38 +86,109 @@ func NewServer(stageClient orchestratorv1.StageRunnerClient, artifactsRoot strin
 	if stageRetryDelay < 0 {
 		stageRetryDelay = 0
 	}
-	return &Server{
+	var store artifacts.Store
+	if artifactsRoot != "" {
+		if fileStore, err := artifacts.NewFileStore(artifactsRoot); err == nil {
+			store = fileStore
+		}
+	}
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	s := &Server{
 		jobs:            make(map[string]*Job),
 		stageClient:     stageClient,
 		artifactsRoot:   artifactsRoot,
+		store:           store,
+		ids:             jobid.NewGenerator(jobid.DefaultInstance()),
 		stageTimeout:    stageTimeout,
 		stageRetries:    stageRetries,
 		stageRetryDelay: stageRetryDelay,
+		runCtx:          runCtx,
+		cancelRuns:      cancelRuns,
 	}
+	// Assume the stage is up until a monitor says otherwise.
+	s.stageAvailable.Store(true)
+	return s
 }
 
 func (s *Server) ExecuteWorkflow(ctx context.Context, req *orchestratorv1.ExecuteWorkflowRequest) (*orchestratorv1.ExecuteWorkflowResponse, error) {
-	jobID := fmt.Sprintf("wf-%d", time.Now().UnixNano())
-	job := &Job{ID: jobID, State: "queued", UpdatedAt: time.Now()}
+	submittedBy := req.GetMetadata()[MetadataSubmittedBy]
+	maxActive, _ := strconv.Atoi(req.GetMetadata()[MetadataMaxActiveJobs])
+
+	jobID := s.newJobID()
+	now := time.Now()
+	job := &Job{ID: jobID, State: "queued", UpdatedAt: now, SubmittedAt: now, SubmittedBy: submittedBy, request: req}
 
+	// The quota check and the insert share one critical section so concurrent
+	// submissions cannot overshoot it.
 	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		jobsRejected.Inc("draining")
+		return nil, status.Error(codes.Unavailable, "orchestrator is shutting down")
+	}
+	if !s.stageAvailable.Load() {
+		s.mu.Unlock()
+		jobsRejected.Inc("stage_unavailable")
+		return nil, status.Error(codes.Unavailable, "stage backend unavailable")
+	}
+	if maxActive > 0 && submittedBy != "" {
+		if active := s.activeJobsLocked(submittedBy); active >= maxActive {
+			s.mu.Unlock()
+			jobsRejected.Inc("quota")
+			slog.WarnContext(ctx, "job rejected by quota", "submitted_by", submittedBy, "active", active, "max_active_jobs", maxActive)
+			return nil, status.Errorf(codes.ResourceExhausted, "%s has %d active jobs, the limit is %d", submittedBy, active, maxActive)
+		}
+	}
+	_, job.queueSpan = tracing.Start(ctx, "orchestrator.queue")
+	job.queueSpan.SetAttribute("job.id", jobID)
+	job.trace = tracing.SpanContextFromContext(ctx)
 	s.jobs[jobID] = job
+	s.inflight.Add(1)
 	s.mu.Unlock()
+	jobsSubmitted.Inc()
+	slog.InfoContext(logging.WithJob(ctx, jobID), "job queued", "submitted_by", job.SubmittedBy, "auth_method", req.GetMetadata()[MetadataAuthMethod])
 
-	go s.runJob(jobID, req)
+	go func() {
+		defer s.inflight.Done()
+		defer s.releaseRequest(jobID)
+		s.runJob(jobID, req)
+	}()
 
 	return &orchestratorv1.ExecuteWorkflowResponse{WorkflowId: jobID}, nil
 }
 
+// activeJobsLocked counts submittedBy's queued and running jobs. Callers hold s.mu.
+func (s *Server) activeJobsLocked(submittedBy string) int {
+	active := 0
+	for _, job := range s.jobs {
+		if job.SubmittedBy == submittedBy && (job.State == "queued" || job.State == "running") {
+			active++
+		}
+	}
+	return active
+}
+
 func (s *Server) GetWorkflowStatus(ctx context.Context, req *orchestratorv1.StatusRequest) (*orchestratorv1.StatusResponse, error) {
+	if err := jobid.Validate(req.WorkflowId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	job := s.getJob(req.WorkflowId)
 	if job == nil {
 		return &orchestratorv1.StatusResponse{WorkflowId: req.WorkflowId, State: "unknown", Message: "not found"}, nil
 	}
-	return &orchestratorv1.StatusResponse{WorkflowId: job.ID, State: job.State, Message: job.Message}, nil
+	return &orchestratorv1.StatusResponse{
+		WorkflowId: job.ID,
+		State:      job.State,
+		Message:    job.Message,
+		Timing:     s.timingFor(job),
+		Output:     job.Output,
+	}, nil
 }
 
 func (s *Server) StreamStatus(req *orchestratorv1.StatusRequest, stream orchestratorv1.Orchestrator_StreamStatusServer) error {
+	if err := jobid.Validate(req.WorkflowId); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -93,6 +204,7 @@ func (s *Server) StreamStatus(req *orchestratorv1.StatusRequest, stream orchestr
 			Message:    job.Message,
 			Progress:   job.Progress,
 			Nodes:      cloneNodeStates(job.NodeStates),
+			Timing:     s.timingFor(job),
 		}
 
 		if err := stream.Send(event); err != nil {
@@ -177,10 +289,16 @@ func (s *Server) ListNodes(ctx context.Context, req *orchestratorv1.ListNodesReq
 
 func (s *Server) runJob(jobID string, req *orchestratorv1.ExecuteWorkflowRequest) {
 	spec := parseWorkflow(req)
+	parent := s.markDispatched(jobID)
 	s.updateJob(jobID, "running", "dispatched", 0.1)
 	s.initNodeStates(jobID, req)
 
-	ctx := context.Background()
+	ctx, span := tracing.Start(tracing.ContextWithSpanContext(s.runCtx, parent), "orchestrator.run_job")
+	defer span.End()
+	span.SetAttribute("job.id", jobID)
+	ctx = logging.WithJob(ctx, jobID)
+	defer logging.CloseJobLog(ctx, jobID)
+	slog.InfoContext(ctx, "job dispatched", "checkpoint", spec.Checkpoint, "width", spec.Width, "height", spec.Height, "steps", spec.Steps)
 
 	params := map[string]string{
 		"checkpoint": spec.Checkpoint,
@@ -193,6 +311,21 @@ func (s *Server) runJob(jobID string, req *orchestratorv1.ExecuteWorkflowRequest
 		"cfg":        fmt.Sprintf("%.2f", spec.Cfg),
 		"sampler":    spec.Sampler,
 		"scheduler":  spec.Scheduler,
+		"format":     spec.Format,
+		"quality":    strconv.Itoa(spec.Quality),
+	}
+	// The submitted graph travels with the stage so outputs can embed it,
+	// under the key ComfyUI uses for its format.
+	if workflowJSON := req.GetGraph().GetWorkflowJson(); workflowJSON != "" {
+		key := "workflow"
+		if format, err := workflowFormat(req); err == nil && format == FormatComfyUIAPI {
+			key = "prompt"
+		}
+		params[key] = workflowJSON
+	}
+	// ComfyUI clients send the UI graph alongside an API prompt as extra_pnginfo.
+	if workflowJSON := req.GetMetadata()["workflow"]; workflowJSON != "" && params["workflow"] == "" {
+		params["workflow"] = workflowJSON
 	}
 
 	stageReq := &orchestratorv1.StageRequest{
@@ -206,13 +339,16 @@ func (s *Server) runJob(jobID string, req *orchestratorv1.ExecuteWorkflowRequest
 	ksamplerNodes := nodeIDsForTypes(nodes, "KSampler")
 	postNodes := nodeIDsForTypes(nodes, "VAEDecode", "SaveImage")
 
-	s.updateNodeState(jobID, preNodes, "completed")
-	s.updateNodeState(jobID, ksamplerNodes, "running")
+	s.updateNodeState(ctx, jobID, preNodes, "completed")
+	s.updateNodeState(ctx, jobID, ksamplerNodes, "running")
 
+	s.startStage(jobID, stageReq)
 	stageResp, err := s.runStageWithRetries(ctx, jobID, stageReq)
+	s.finishStage(jobID, stageStatus(stageResp, err))
 	if err != nil {
-		log.Printf("stage run failed job=%s err=%v", jobID, err)
-		s.updateNodeState(jobID, ksamplerNodes, "failed")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "stage run failed", "err", err)
+		s.updateNodeState(ctx, jobID, ksamplerNodes, "failed")
 		s.updateJob(jobID, "failed", stageErrorMessage(err, s.stageTimeout), 1)
 		return
 	}
@@ -222,8 +358,9 @@ func (s *Server) runJob(jobID string, req *orchestratorv1.ExecuteWorkflowRequest
 		if stageResp != nil && stageResp.ErrorMessage != "" {
 			message = stageResp.ErrorMessage
 		}
-		log.Printf("stage run failed job=%s status=%s err=%s", jobID, stageResp.GetStatus(), message)
-		s.updateNodeState(jobID, ksamplerNodes, "failed")
+		span.RecordError(errors.New(message))
+		slog.ErrorContext(ctx, "stage run failed", "status", stageResp.GetStatus(), "err", message)
+		s.updateNodeState(ctx, jobID, ksamplerNodes, "failed")
 		s.updateJob(jobID, "failed", message, 1)
 		return
 	}
@@ -233,17 +370,25 @@ func (s *Server) runJob(jobID string, req *orchestratorv1.ExecuteWorkflowRequest
 	if output != nil {
 		outputURI = output.Uri
 	} else {
-		log.Printf("stage response missing image output job=%s", jobID)
+		slog.WarnContext(ctx, "stage response missing image output")
 	}
 
 	if outputURI == "" {
-		s.updateNodeState(jobID, ksamplerNodes, "failed")
+		s.updateNodeState(ctx, jobID, ksamplerNodes, "failed")
 		s.updateJob(jobID, "failed", "stage returned no output", 1)
 		return
 	}
 
-	s.updateNodeState(jobID, ksamplerNodes, "completed")
-	s.updateNodeState(jobID, postNodes, "completed")
+	if err := s.verifyRefs(ctx, stageResp.OutputRefs); err != nil {
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "stage output failed verification", "err", err)
+		s.updateNodeState(ctx, jobID, ksamplerNodes, "failed")
+		s.updateJob(jobID, "failed", integrityMessage(err), 1)
+		return
+	}
+
+	s.updateNodeState(ctx, jobID, ksamplerNodes, "completed")
+	s.updateNodeState(ctx, jobID, postNodes, "completed")
 
 	s.mu.Lock()
 	job := s.jobs[jobID]
@@ -252,9 +397,13 @@ func (s *Server) runJob(jobID string, req *orchestratorv1.ExecuteWorkflowRequest
 		job.Message = outputURI
 		job.Progress = 1
 		job.OutputURI = outputURI
+		job.Output = output
 		job.UpdatedAt = time.Now()
+		job.CompletedAt = job.UpdatedAt
 	}
 	s.mu.Unlock()
+	jobsFinished.Inc("completed")
+	slog.InfoContext(ctx, "job completed", "output", outputURI)
 }
 
 func (s *Server) runStageWithRetries(ctx context.Context, jobID string, req *orchestratorv1.StageRequest) (*orchestratorv1.StageResult, error) {
@@ -262,8 +411,19 @@ func (s *Server) runStageWithRetries(ctx context.Context, jobID string, req *orc
 	var lastErr error
 	for attempt := 1; attempt <= attempts; attempt++ {
 		attemptCtx, cancel := context.WithTimeout(ctx, s.stageTimeout)
+		attemptCtx, attemptSpan := tracing.Start(attemptCtx, "orchestrator.stage_attempt")
+		attemptSpan.SetAttribute("job.id", jobID)
+		attemptSpan.SetAttribute("stage.node_type", req.GetNodeType())
+		attemptSpan.SetAttribute("stage.attempt", attempt)
+		attemptCtx = logging.WithAttempt(logging.WithStage(attemptCtx, req.GetNodeType()), attempt)
+		attemptCtx = metadata.AppendToOutgoingContext(attemptCtx, logging.AttemptMetadataKey, strconv.Itoa(attempt))
+		started := time.Now()
+		stageAttempts.Inc(req.GetNodeType())
 		resp, err := s.stageClient.RunStage(attemptCtx, req)
 		cancel()
+		attemptSpan.RecordError(err)
+		attemptSpan.End()
+		s.recordAttempt(jobID, attempt, started, err)
 		if err == nil {
 			return resp, nil
 		}
@@ -271,6 +431,8 @@ func (s *Server) runStageWithRetries(ctx context.Context, jobID string, req *orc
 		if !isRetryableStageError(err) || attempt == attempts {
 			return nil, err
 		}
+		stageRetries.Inc(req.GetNodeType())
+		slog.WarnContext(logging.WithAttempt(logging.WithStage(ctx, req.GetNodeType()), attempt), "stage unavailable, retrying", "err", err)
 		message := fmt.Sprintf("stage unavailable, retrying (%d/%d)", attempt, attempts)
 		s.updateJob(jobID, "running", message, 0.1)
 		delay := s.stageRetryDelay * time.Duration(attempt)
@@ -288,6 +450,16 @@ func (s *Server) runStageWithRetries(ctx context.Context, jobID string, req *orc
 	return nil, lastErr
 }
 
+func stageStatus(resp *orchestratorv1.StageResult, err error) string {
+	if err != nil {
+		return "error"
+	}
+	if resp == nil || resp.Status == "" {
+		return "unknown"
+	}
+	return resp.Status
+}
+
 func isRetryableStageError(err error) bool {
 	if err == nil {
 		return false
@@ -332,8 +504,14 @@ func (s *Server) updateJob(jobID, state, message string, progress float64) {
 		job.Message = message
 		job.Progress = progress
 		job.UpdatedAt = time.Now()
+		if state == "completed" || state == "failed" {
+			job.CompletedAt = job.UpdatedAt
+		}
 	}
 	s.mu.Unlock()
+	if job != nil && (state == "completed" || state == "failed") {
+		jobsFinished.Inc(state)
+	}
 }
 
 func (s *Server) getJob(id string) *Job {
@@ -367,7 +545,7 @@ func (s *Server) initNodeStates(jobID string, req *orchestratorv1.ExecuteWorkflo
 	s.mu.Unlock()
 }
 
-func (s *Server) updateNodeState(jobID string, nodeIDs []int64, state string) {
+func (s *Server) updateNodeState(ctx context.Context, jobID string, nodeIDs []int64, state string) {
 	if len(nodeIDs) == 0 {
 		return
 	}
@@ -391,6 +569,10 @@ func (s *Server) updateNodeState(jobID string, nodeIDs []int64, state string) {
 	}
 	job.UpdatedAt = time.Now()
 	s.mu.Unlock()
+
+	for _, id := range nodeIDs {
+		slog.DebugContext(logging.WithNode(ctx, id), "node state changed", "state", state)
+	}
 }
 
 func nodeIDsForTypes(nodes []workflowNode, types ...string) []int64 {
@@ -429,8 +611,7 @@ func cloneNodeStates(states map[int64]*orchestratorv1.NodeState) []*orchestrator
 		if state == nil {
 			continue
 		}
-		copy := *state
-		nodes = append(nodes, &copy)
+		nodes = append(nodes, proto.Clone(state).(*orchestratorv1.NodeState))
 	}
 	return nodes
 }
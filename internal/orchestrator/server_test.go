@@ -9,7 +9,9 @@ import (
 
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type fakeStageClient struct {
@@ -35,7 +37,7 @@ func TestExecuteWorkflowUpdatesJob(t *testing.T) {
 		StageId: "job",
 		Status:  "completed",
 		OutputRefs: map[string]*orchestratorv1.TensorRef{
-			"image": {Uri: "/tmp/output.png"},
+			"image": {Uri: "artifact://job/output.png"},
 		},
 	}}
 	server := NewServer(fake, "/artifacts", time.Second, 0, 0)
@@ -153,3 +155,49 @@ func (f *fakeStatusStream) SetTrailer(metadata.MD)       {}
 func (f *fakeStatusStream) Context() context.Context     { return f.ctx }
 func (f *fakeStatusStream) SendMsg(any) error            { return nil }
 func (f *fakeStatusStream) RecvMsg(any) error            { return nil }
+
+// blockingStageClient holds every RunStage call until release is closed.
+type blockingStageClient struct {
+	fakeStageClient
+	release chan struct{}
+}
+
+func (b *blockingStageClient) RunStage(ctx context.Context, req *orchestratorv1.StageRequest, opts ...grpc.CallOption) (*orchestratorv1.StageResult, error) {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.fakeStageClient.RunStage(ctx, req, opts...)
+}
+
+func TestExecuteWorkflowEnforcesActiveJobQuota(t *testing.T) {
+	stage := &blockingStageClient{
+		fakeStageClient: fakeStageClient{resp: &orchestratorv1.StageResult{Status: "completed"}},
+		release:         make(chan struct{}),
+	}
+	defer close(stage.release)
+	server := NewServer(stage, "/artifacts", time.Minute, 0, 0)
+
+	submit := func(submittedBy, limit string) error {
+		_, err := server.ExecuteWorkflow(context.Background(), &orchestratorv1.ExecuteWorkflowRequest{
+			Graph:    &orchestratorv1.WorkflowGraph{WorkflowJson: `{"nodes":[]}`},
+			Metadata: map[string]string{MetadataSubmittedBy: submittedBy, MetadataMaxActiveJobs: limit},
+		})
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := submit("ci", "2"); err != nil {
+			t.Fatalf("submit %d: %v", i, err)
+		}
+	}
+	if err := submit("ci", "2"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted over quota, got %v", err)
+	}
+	if err := submit("other", "2"); err != nil {
+		t.Fatalf("expected quotas to be per submitter: %v", err)
+	}
+	if err := submit("ci", ""); err != nil {
+		t.Fatalf("expected no quota without a limit: %v", err)
+	}
+}
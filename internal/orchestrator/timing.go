@@ -0,0 +1,155 @@
+package orchestrator
+
+import (
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"comfy-service-tests/internal/tracing"
+)
+
+// StageTiming records when a stage ran and how each attempt went.
+type StageTiming struct {
+	StageID    string
+	NodeType   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Attempts   []StageAttempt
+}
+
+// StageAttempt records a single RunStage call, including retries.
+type StageAttempt struct {
+	Attempt    int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Error      string
+}
+
+// markDispatched records the end of queueing and returns the trace the job was submitted under.
+func (s *Server) markDispatched(jobID string) tracing.SpanContext {
+	s.mu.Lock()
+	job := s.jobs[jobID]
+	if job == nil {
+		s.mu.Unlock()
+		return tracing.SpanContext{}
+	}
+	job.DispatchedAt = time.Now()
+	queueSpan := job.queueSpan
+	parent := job.trace
+	s.mu.Unlock()
+
+	queueSpan.End()
+	return parent
+}
+
+func (s *Server) startStage(jobID string, req *orchestratorv1.StageRequest) {
+	s.mu.Lock()
+	job := s.jobs[jobID]
+	if job != nil {
+		job.Stages = append(job.Stages, &StageTiming{
+			StageID:   req.GetStageId(),
+			NodeType:  req.GetNodeType(),
+			StartedAt: time.Now(),
+		})
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) finishStage(jobID, status string) {
+	s.mu.Lock()
+	stage := s.currentStage(jobID)
+	if stage != nil {
+		stage.FinishedAt = time.Now()
+		stageDuration.Observe(stage.FinishedAt.Sub(stage.StartedAt).Seconds(), stage.NodeType, status)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) recordAttempt(jobID string, attempt int, started time.Time, err error) {
+	entry := StageAttempt{Attempt: attempt, StartedAt: started, FinishedAt: time.Now()}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	if stage := s.currentStage(jobID); stage != nil {
+		stage.Attempts = append(stage.Attempts, entry)
+	}
+	s.mu.Unlock()
+}
+
+// currentStage returns the most recently started stage; callers hold s.mu.
+func (s *Server) currentStage(jobID string) *StageTiming {
+	job := s.jobs[jobID]
+	if job == nil || len(job.Stages) == 0 {
+		return nil
+	}
+	return job.Stages[len(job.Stages)-1]
+}
+
+func (s *Server) timingFor(job *Job) *orchestratorv1.JobTiming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return jobTiming(job, time.Now())
+}
+
+// jobTiming converts the recorded timestamps into the wire format; callers hold s.mu.
+func jobTiming(job *Job, now time.Time) *orchestratorv1.JobTiming {
+	if job == nil || job.SubmittedAt.IsZero() {
+		return nil
+	}
+
+	timing := &orchestratorv1.JobTiming{
+		SubmittedAtUnixMs:  unixMillis(job.SubmittedAt),
+		DispatchedAtUnixMs: unixMillis(job.DispatchedAt),
+		CompletedAtUnixMs:  unixMillis(job.CompletedAt),
+	}
+
+	if job.DispatchedAt.IsZero() {
+		timing.QueueWaitMs = durationMillis(job.SubmittedAt, now)
+	} else {
+		timing.QueueWaitMs = durationMillis(job.SubmittedAt, job.DispatchedAt)
+	}
+	end := job.CompletedAt
+	if end.IsZero() {
+		end = now
+	}
+	timing.TotalMs = durationMillis(job.SubmittedAt, end)
+
+	for _, stage := range job.Stages {
+		stageEnd := stage.FinishedAt
+		if stageEnd.IsZero() {
+			stageEnd = now
+		}
+		entry := &orchestratorv1.StageTiming{
+			StageId:         stage.StageID,
+			NodeType:        stage.NodeType,
+			StartedAtUnixMs: unixMillis(stage.StartedAt),
+			DurationMs:      durationMillis(stage.StartedAt, stageEnd),
+		}
+		for _, attempt := range stage.Attempts {
+			entry.Attempts = append(entry.Attempts, &orchestratorv1.StageAttempt{
+				Attempt:         int32(attempt.Attempt),
+				StartedAtUnixMs: unixMillis(attempt.StartedAt),
+				DurationMs:      durationMillis(attempt.StartedAt, attempt.FinishedAt),
+				Error:           attempt.Error,
+			})
+		}
+		timing.Stages = append(timing.Stages, entry)
+	}
+
+	return timing
+}
+
+func unixMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func durationMillis(start, end time.Time) int64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start).Milliseconds()
+}
@@ -0,0 +1,81 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type flakyStageClient struct {
+	fakeStageClient
+	failures int
+	calls    int
+}
+
+func (f *flakyStageClient) RunStage(ctx context.Context, req *orchestratorv1.StageRequest, opts ...grpc.CallOption) (*orchestratorv1.StageResult, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, status.Error(codes.Unavailable, "stage warming up")
+	}
+	return f.fakeStageClient.RunStage(ctx, req, opts...)
+}
+
+func TestRunJobRecordsTiming(t *testing.T) {
+	fake := &flakyStageClient{
+		failures: 1,
+		fakeStageClient: fakeStageClient{resp: &orchestratorv1.StageResult{
+			Status:     "completed",
+			OutputRefs: map[string]*orchestratorv1.TensorRef{"image": {Uri: "artifact://job/output.png"}},
+		}},
+	}
+	server := NewServer(fake, "/artifacts", time.Second, 1, 0)
+	server.jobs["job-3"] = &Job{ID: "job-3", State: "queued", SubmittedAt: time.Now()}
+
+	server.runJob("job-3", &orchestratorv1.ExecuteWorkflowRequest{})
+
+	status, err := server.GetWorkflowStatus(context.Background(), &orchestratorv1.StatusRequest{WorkflowId: "job-3"})
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status.State != "completed" {
+		t.Fatalf("expected completed state, got %s", status.State)
+	}
+	timing := status.Timing
+	if timing == nil {
+		t.Fatalf("expected timing")
+	}
+	if timing.DispatchedAtUnixMs == 0 || timing.CompletedAtUnixMs == 0 {
+		t.Fatalf("expected dispatch and completion timestamps: %+v", timing)
+	}
+	if len(timing.Stages) != 1 {
+		t.Fatalf("expected 1 stage, got %d", len(timing.Stages))
+	}
+	attempts := timing.Stages[0].Attempts
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(attempts))
+	}
+	if attempts[0].Error == "" || attempts[1].Error != "" {
+		t.Fatalf("unexpected attempt errors: %q %q", attempts[0].Error, attempts[1].Error)
+	}
+}
+
+func TestJobTimingPending(t *testing.T) {
+	submitted := time.Unix(100, 0)
+	job := &Job{ID: "job-4", SubmittedAt: submitted}
+
+	timing := jobTiming(job, submitted.Add(1500*time.Millisecond))
+	if timing.QueueWaitMs != 1500 || timing.TotalMs != 1500 {
+		t.Fatalf("unexpected pending timing: wait=%d total=%d", timing.QueueWaitMs, timing.TotalMs)
+	}
+	if timing.DispatchedAtUnixMs != 0 || timing.CompletedAtUnixMs != 0 {
+		t.Fatalf("expected unset timestamps, got %+v", timing)
+	}
+	if jobTiming(&Job{ID: "job-5"}, time.Now()) != nil {
+		t.Fatalf("expected nil timing without submission time")
+	}
+}
@@ -2,6 +2,8 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
+	"strings"
 
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
 )
@@ -28,6 +30,8 @@ type workflowSpec struct {
 	Cfg        float64
 	Sampler    string
 	Scheduler  string
+	Format     string
+	Quality    int
 }
 
 func parseWorkflow(req *orchestratorv1.ExecuteWorkflowRequest) workflowSpec {
@@ -38,14 +42,12 @@ func parseWorkflow(req *orchestratorv1.ExecuteWorkflowRequest) workflowSpec {
 		Cfg:       8,
 		Sampler:   "euler",
 		Scheduler: "normal",
+		Format:    "png",
+		Quality:   90,
 	}
 
-	if req == nil || req.Graph == nil {
-		return spec
-	}
-
-	var graph workflowGraph
-	if err := json.Unmarshal([]byte(req.Graph.WorkflowJson), &graph); err != nil {
+	graph, err := decodeWorkflow(req)
+	if err != nil {
 		return spec
 	}
 
@@ -67,6 +69,12 @@ func parseWorkflow(req *orchestratorv1.ExecuteWorkflowRequest) workflowSpec {
 			spec.Cfg = floatValue(node.WidgetsValues, 2, spec.Cfg)
 			spec.Sampler = stringValue(node.WidgetsValues, 3)
 			spec.Scheduler = stringValue(node.WidgetsValues, 4)
+		case "SaveImage":
+			// widgets: filename_prefix, format, quality
+			if format := stringValue(node.WidgetsValues, 1); format != "" {
+				spec.Format = strings.ToLower(format)
+			}
+			spec.Quality = intValue(node.WidgetsValues, 2, spec.Quality)
 		}
 	}
 
@@ -81,16 +89,44 @@ func parseWorkflow(req *orchestratorv1.ExecuteWorkflowRequest) workflowSpec {
 }
 
 func parseWorkflowNodes(req *orchestratorv1.ExecuteWorkflowRequest) []workflowNode {
-	if req == nil || req.Graph == nil {
+	graph, err := decodeWorkflow(req)
+	if err != nil {
 		return nil
 	}
 
-	var graph workflowGraph
-	if err := json.Unmarshal([]byte(req.Graph.WorkflowJson), &graph); err != nil {
-		return nil
+	return graph.Nodes
+}
+
+// workflowFormat returns the request's declared format, detecting it from the
+// JSON when the gateway did not set a known one.
+func workflowFormat(req *orchestratorv1.ExecuteWorkflowRequest) (string, error) {
+	switch format := req.GetGraph().GetFormat(); format {
+	case FormatComfyUI, FormatComfyUIAPI:
+		return format, nil
 	}
+	return DetectWorkflowFormat([]byte(req.GetGraph().GetWorkflowJson()))
+}
 
-	return graph.Nodes
+// decodeWorkflow parses either ComfyUI save format into the internal graph.
+// An explicit Graph.Format wins; otherwise the format is detected from the JSON.
+func decodeWorkflow(req *orchestratorv1.ExecuteWorkflowRequest) (workflowGraph, error) {
+	if req == nil || req.Graph == nil {
+		return workflowGraph{}, errors.New("missing workflow graph")
+	}
+	payload := []byte(req.Graph.WorkflowJson)
+	format, err := workflowFormat(req)
+	if err != nil {
+		return workflowGraph{}, err
+	}
+
+	if format == FormatComfyUIAPI {
+		return decodeAPIWorkflow(payload)
+	}
+	var graph workflowGraph
+	if err := json.Unmarshal(payload, &graph); err != nil {
+		return workflowGraph{}, err
+	}
+	return graph, nil
 }
 
 func stringValue(values []any, index int) string {
@@ -0,0 +1,197 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// WorkflowGraph.Format values. The UI (litegraph) save format has a "nodes"
+// array; the API format maps node ids to {"class_type", "inputs"}.
+const (
+	FormatComfyUI    = "comfyui"
+	FormatComfyUIAPI = "comfyui-api"
+)
+
+// ErrUnknownWorkflowFormat is returned for JSON in neither ComfyUI format.
+var ErrUnknownWorkflowFormat = errors.New("unrecognised workflow format")
+
+// DetectWorkflowFormat reports which ComfyUI format payload is in.
+func DetectWorkflowFormat(payload []byte) (string, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &top); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnknownWorkflowFormat, err)
+	}
+	if nodes, ok := top["nodes"]; ok && len(nodes) > 0 && nodes[0] == '[' {
+		return FormatComfyUI, nil
+	}
+	if len(top) == 0 {
+		return "", fmt.Errorf("%w: empty graph", ErrUnknownWorkflowFormat)
+	}
+	for id, raw := range top {
+		var node apiNode
+		if err := json.Unmarshal(raw, &node); err != nil || node.ClassType == "" {
+			return "", fmt.Errorf("%w: node %q has no class_type", ErrUnknownWorkflowFormat, id)
+		}
+	}
+	return FormatComfyUIAPI, nil
+}
+
+type apiNode struct {
+	ClassType string                     `json:"class_type"`
+	Inputs    map[string]json.RawMessage `json:"inputs"`
+}
+
+// apiWidgetInputs lists, per node type, the API inputs that correspond to the
+// widgets_values positions parseWorkflow reads.
+var apiWidgetInputs = map[string][]string{
+	"CheckpointLoaderSimple": {"ckpt_name"},
+	"LoadCheckpoint":         {"ckpt_name"},
+	"CLIPTextEncode":         {"text"},
+	"CLIPTextEncodePrompt":   {"text"},
+	"EmptyLatentImage":       {"width", "height", "batch_size"},
+	"KSampler":               {"seed", "steps", "cfg", "sampler_name", "scheduler", "denoise"},
+	"SaveImage":              {"filename_prefix", "format", "quality"},
+}
+
+// decodeAPIWorkflow converts an API-format prompt into the internal graph.
+// Literal inputs become widget values; linked inputs ([node, slot]) are left
+// unset so defaults apply. Text encoders feeding a KSampler's positive and
+// negative inputs are ordered first, matching the UI-format convention that
+// the first prompt is positive and the second negative.
+func decodeAPIWorkflow(payload []byte) (workflowGraph, error) {
+	var prompt map[string]apiNode
+	if err := json.Unmarshal(payload, &prompt); err != nil {
+		return workflowGraph{}, err
+	}
+
+	keys := sortedKeys(prompt)
+	rank := promptRanks(prompt, keys)
+	sort.SliceStable(keys, func(i, j int) bool { return rank[keys[i]] < rank[keys[j]] })
+
+	ids := apiNodeIDs(keys)
+	graph := workflowGraph{Nodes: make([]workflowNode, 0, len(keys))}
+	for _, key := range keys {
+		node := prompt[key]
+		names := apiWidgetInputs[node.ClassType]
+		values := make([]any, len(names))
+		for i, name := range names {
+			values[i] = literalInput(node.Inputs[name])
+		}
+		graph.Nodes = append(graph.Nodes, workflowNode{
+			ID:            ids[key],
+			Type:          node.ClassType,
+			WidgetsValues: values,
+		})
+	}
+	return graph, nil
+}
+
+// promptRanks puts the text encoders linked to a KSampler's positive input
+// first and its negative input second; everything else ranks after them.
+func promptRanks(prompt map[string]apiNode, keys []string) map[string]int {
+	rank := make(map[string]int, len(prompt))
+	for key := range prompt {
+		rank[key] = 2
+	}
+	for _, key := range keys {
+		node := prompt[key]
+		if node.ClassType != "KSampler" {
+			continue
+		}
+		if source, ok := linkSource(node.Inputs["positive"]); ok {
+			if _, exists := prompt[source]; exists {
+				rank[source] = 0
+			}
+		}
+		if source, ok := linkSource(node.Inputs["negative"]); ok {
+			if _, exists := prompt[source]; exists && rank[source] != 0 {
+				rank[source] = 1
+			}
+		}
+		break
+	}
+	return rank
+}
+
+// apiNodeIDs keeps numeric node ids and numbers the rest (e.g. "12:3" from
+// group nodes) after the largest numeric id.
+func apiNodeIDs(keys []string) map[string]int {
+	ids := make(map[string]int, len(keys))
+	next := 0
+	for _, key := range keys {
+		if id, err := strconv.Atoi(key); err == nil && id >= 0 {
+			ids[key] = id
+			if id >= next {
+				next = id + 1
+			}
+		}
+	}
+	for _, key := range keys {
+		if _, ok := ids[key]; !ok {
+			ids[key] = next
+			next++
+		}
+	}
+	return ids
+}
+
+func sortedKeys(prompt map[string]apiNode) []string {
+	keys := make([]string, 0, len(prompt))
+	for key := range prompt {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessNodeKey(keys[i], keys[j]) })
+	return keys
+}
+
+// lessNodeKey orders numeric ids numerically and other keys after them.
+func lessNodeKey(a, b string) bool {
+	ai, errA := strconv.Atoi(a)
+	bi, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return ai < bi
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	}
+	return a < b
+}
+
+// linkSource returns the source node id of a [node, slot] link input.
+func linkSource(raw json.RawMessage) (string, bool) {
+	var link []json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &link) != nil || len(link) != 2 {
+		return "", false
+	}
+	var id string
+	if json.Unmarshal(link[0], &id) == nil {
+		return id, true
+	}
+	var numeric int
+	if json.Unmarshal(link[0], &numeric) == nil {
+		return strconv.Itoa(numeric), true
+	}
+	return "", false
+}
+
+// literalInput decodes strings and numbers; links and missing inputs yield nil.
+func literalInput(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil
+	}
+	switch value.(type) {
+	case string, float64, bool:
+		return value
+	default:
+		return nil
+	}
+}
@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 
 	orchestratorv1 "comfy-service-tests/internal/proto/orchestratorv1"
@@ -27,6 +28,9 @@ func TestParseWorkflowDefaults(t *testing.T) {
 	if spec.Sampler != "euler" || spec.Scheduler != "normal" {
 		t.Fatalf("unexpected defaults: sampler=%s scheduler=%s", spec.Sampler, spec.Scheduler)
 	}
+	if spec.Format != "png" || spec.Quality != 90 {
+		t.Fatalf("unexpected defaults: format=%s quality=%d", spec.Format, spec.Quality)
+	}
 }
 
 func TestParseWorkflowFromGraph(t *testing.T) {
@@ -37,6 +41,7 @@ func TestParseWorkflowFromGraph(t *testing.T) {
 			{Type: "CLIPTextEncode", WidgetsValues: []any{"negative"}},
 			{Type: "EmptyLatentImage", WidgetsValues: []any{640.0, 384.0}},
 			{Type: "KSampler", WidgetsValues: []any{1234.0, 30.0, 6.5, "euler_a", "karras"}},
+			{Type: "SaveImage", WidgetsValues: []any{"ComfyUI", "JPEG", 75.0}},
 		},
 	}
 
@@ -65,6 +70,9 @@ func TestParseWorkflowFromGraph(t *testing.T) {
 	if spec.Sampler != "euler_a" || spec.Scheduler != "karras" {
 		t.Fatalf("unexpected scheduler: %s %s", spec.Sampler, spec.Scheduler)
 	}
+	if spec.Format != "jpeg" || spec.Quality != 75 {
+		t.Fatalf("unexpected output format: %s quality=%d", spec.Format, spec.Quality)
+	}
 }
 
 func TestParseWorkflowInvalidJSON(t *testing.T) {
@@ -108,3 +116,56 @@ func TestValueHelpers(t *testing.T) {
 		t.Fatalf("floatValue fallback unexpected: %v", got)
 	}
 }
+
+const apiPrompt = `{
+	"3": {"class_type": "KSampler", "inputs": {"seed": 99, "steps": 12, "cfg": 5.5, "sampler_name": "ddim", "scheduler": "karras",
+		"model": ["4", 0], "positive": ["7", 0], "negative": ["6", 0], "latent_image": ["5", 0]}},
+	"4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "api.safetensors"}},
+	"5": {"class_type": "EmptyLatentImage", "inputs": {"width": 768, "height": ["10", 0], "batch_size": 1}},
+	"6": {"class_type": "CLIPTextEncode", "inputs": {"text": "blurry", "clip": ["4", 1]}},
+	"7": {"class_type": "CLIPTextEncode", "inputs": {"text": "a red fox", "clip": ["4", 1]}},
+	"9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "ComfyUI", "images": ["8", 0]}},
+	"10:1": {"class_type": "PrimitiveNode", "inputs": {}}
+}`
+
+func TestDetectWorkflowFormat(t *testing.T) {
+	cases := map[string]string{
+		`{"nodes": [], "links": []}`: FormatComfyUI,
+		apiPrompt:                    FormatComfyUIAPI,
+	}
+	for payload, want := range cases {
+		got, err := DetectWorkflowFormat([]byte(payload))
+		if err != nil || got != want {
+			t.Fatalf("DetectWorkflowFormat = %q, %v; want %q", got, err, want)
+		}
+	}
+	for _, payload := range []string{`[]`, `{}`, `{"3": {"inputs": {}}}`, `not json`} {
+		if _, err := DetectWorkflowFormat([]byte(payload)); !errors.Is(err, ErrUnknownWorkflowFormat) {
+			t.Fatalf("payload %s: expected unknown format, got %v", payload, err)
+		}
+	}
+}
+
+func TestParseWorkflowAPIFormat(t *testing.T) {
+	req := &orchestratorv1.ExecuteWorkflowRequest{
+		Graph: &orchestratorv1.WorkflowGraph{WorkflowJson: apiPrompt},
+	}
+	spec := parseWorkflow(req)
+	if spec.Checkpoint != "api.safetensors" {
+		t.Fatalf("unexpected checkpoint: %s", spec.Checkpoint)
+	}
+	if spec.Positive != "a red fox" || spec.Negative != "blurry" {
+		t.Fatalf("prompts should follow KSampler links, got %q / %q", spec.Positive, spec.Negative)
+	}
+	if spec.Width != 768 || spec.Height != 512 {
+		t.Fatalf("linked height should fall back to default, got %dx%d", spec.Width, spec.Height)
+	}
+	if spec.Seed != 99 || spec.Steps != 12 || spec.Cfg != 5.5 || spec.Sampler != "ddim" || spec.Scheduler != "karras" {
+		t.Fatalf("unexpected sampler params: %+v", spec)
+	}
+
+	nodes := parseWorkflowNodes(req)
+	if len(nodes) != 7 || nodes[0].ID != 7 || nodes[1].ID != 6 || nodes[len(nodes)-1].ID != 10 {
+		t.Fatalf("unexpected node ids: %+v", nodes)
+	}
+}
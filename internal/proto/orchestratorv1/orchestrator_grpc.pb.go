@@ -23,6 +23,7 @@ const (
 	Orchestrator_GetWorkflowStatus_FullMethodName = "/comfy.orchestrator.v1.Orchestrator/GetWorkflowStatus"
 	Orchestrator_StreamStatus_FullMethodName      = "/comfy.orchestrator.v1.Orchestrator/StreamStatus"
 	Orchestrator_ListNodes_FullMethodName         = "/comfy.orchestrator.v1.Orchestrator/ListNodes"
+	Orchestrator_ListWorkflows_FullMethodName     = "/comfy.orchestrator.v1.Orchestrator/ListWorkflows"
 )
 
 // OrchestratorClient is the client API for Orchestrator service.
@@ -33,6 +34,7 @@ type OrchestratorClient interface {
 	GetWorkflowStatus(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
 	StreamStatus(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (Orchestrator_StreamStatusClient, error)
 	ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error)
+	ListWorkflows(ctx context.Context, in *ListWorkflowsRequest, opts ...grpc.CallOption) (*ListWorkflowsResponse, error)
 }
 
 type orchestratorClient struct {
@@ -102,6 +104,15 @@ func (c *orchestratorClient) ListNodes(ctx context.Context, in *ListNodesRequest
 	return out, nil
 }
 
+func (c *orchestratorClient) ListWorkflows(ctx context.Context, in *ListWorkflowsRequest, opts ...grpc.CallOption) (*ListWorkflowsResponse, error) {
+	out := new(ListWorkflowsResponse)
+	err := c.cc.Invoke(ctx, Orchestrator_ListWorkflows_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // OrchestratorServer is the server API for Orchestrator service.
 // All implementations must embed UnimplementedOrchestratorServer
 // for forward compatibility
@@ -110,6 +121,7 @@ type OrchestratorServer interface {
 	GetWorkflowStatus(context.Context, *StatusRequest) (*StatusResponse, error)
 	StreamStatus(*StatusRequest, Orchestrator_StreamStatusServer) error
 	ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error)
+	ListWorkflows(context.Context, *ListWorkflowsRequest) (*ListWorkflowsResponse, error)
 	mustEmbedUnimplementedOrchestratorServer()
 }
 
@@ -129,6 +141,9 @@ func (UnimplementedOrchestratorServer) StreamStatus(*StatusRequest, Orchestrator
 func (UnimplementedOrchestratorServer) ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListNodes not implemented")
 }
+func (UnimplementedOrchestratorServer) ListWorkflows(context.Context, *ListWorkflowsRequest) (*ListWorkflowsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWorkflows not implemented")
+}
 func (UnimplementedOrchestratorServer) mustEmbedUnimplementedOrchestratorServer() {}
 
 // UnsafeOrchestratorServer may be embedded to opt out of forward compatibility for this service.
@@ -217,6 +232,24 @@ func _Orchestrator_ListNodes_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Orchestrator_ListWorkflows_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkflowsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ListWorkflows(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Orchestrator_ListWorkflows_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ListWorkflows(ctx, req.(*ListWorkflowsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Orchestrator_ServiceDesc is the grpc.ServiceDesc for Orchestrator service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -236,6 +269,10 @@ var Orchestrator_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListNodes",
 			Handler:    _Orchestrator_ListNodes_Handler,
 		},
+		{
+			MethodName: "ListWorkflows",
+			Handler:    _Orchestrator_ListWorkflows_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -0,0 +1,399 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter ships finished spans somewhere.
+type Exporter interface {
+	ExportSpans(ctx context.Context, service string, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Provider batches finished spans and hands them to an exporter.
+type Provider struct {
+	service  string
+	exporter Exporter
+	interval time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	pending []SpanData
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	once    sync.Once
+}
+
+func NewProvider(service string, exporter Exporter) *Provider {
+	p := &Provider{
+		service:  service,
+		exporter: exporter,
+		interval: 2 * time.Second,
+		maxBatch: 256,
+		flushCh:  make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+func (p *Provider) enqueue(span SpanData) {
+	p.mu.Lock()
+	p.pending = append(p.pending, span)
+	full := len(p.pending) >= p.maxBatch
+	p.mu.Unlock()
+	if full {
+		select {
+		case p.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *Provider) loop() {
+	defer close(p.doneCh)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.flushCh:
+		case <-p.stopCh:
+			return
+		}
+		if err := p.Flush(context.Background()); err != nil {
+			log.Printf("trace export failed: %v", err)
+		}
+	}
+}
+
+// Flush exports all pending spans.
+func (p *Provider) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	batch := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return p.exporter.ExportSpans(ctx, p.service, batch)
+}
+
+// Shutdown flushes pending spans and closes the exporter. It is a no-op on
+// the nil Provider Setup returns when tracing is disabled.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	var err error
+	p.once.Do(func() {
+		close(p.stopCh)
+		<-p.doneCh
+		if flushErr := p.Flush(ctx); flushErr != nil {
+			err = flushErr
+		}
+		if closeErr := p.exporter.Shutdown(ctx); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// Setup installs a provider chosen by TRACING_EXPORTER (none, stdout, file, otlp).
+// It returns nil when tracing export is disabled; ids are still propagated.
+func Setup(serviceName, logDir string) (*Provider, error) {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		serviceName = name
+	}
+
+	var exporter Exporter
+	switch kind := strings.ToLower(os.Getenv("TRACING_EXPORTER")); kind {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		exporter = NewWriterExporter(nopCloser{os.Stdout})
+	case "file":
+		path := os.Getenv("TRACING_FILE")
+		if path == "" {
+			if logDir == "" {
+				logDir = ".log"
+			}
+			path = filepath.Join(logDir, serviceName+".traces.jsonl")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter = NewWriterExporter(file)
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		if endpoint == "" {
+			base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+			if base == "" {
+				base = "http://localhost:4318"
+			}
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+		exporter = NewOTLPExporter(endpoint, parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")))
+	default:
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", kind)
+	}
+
+	provider := NewProvider(serviceName, exporter)
+	SetProvider(provider)
+	return provider, nil
+}
+
+func parseHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	for _, item := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// WriterExporter writes one JSON object per span, usable offline with jq.
+type WriterExporter struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+}
+
+func NewWriterExporter(out io.WriteCloser) *WriterExporter {
+	return &WriterExporter{out: out}
+}
+
+type jsonSpan struct {
+	Service    string         `json:"service"`
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Start      time.Time      `json:"start"`
+	DurationMs float64        `json:"duration_ms"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func (e *WriterExporter) ExportSpans(ctx context.Context, service string, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.out)
+	for _, span := range spans {
+		entry := jsonSpan{
+			Service:    service,
+			Name:       span.Name,
+			Kind:       span.Kind.String(),
+			TraceID:    span.TraceID.String(),
+			SpanID:     span.SpanID.String(),
+			Start:      span.Start.UTC(),
+			DurationMs: float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+			Attributes: span.Attributes,
+			Error:      span.Error,
+		}
+		if span.ParentID.IsValid() {
+			entry.ParentID = span.ParentID.String()
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.out.Close()
+}
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector using the JSON encoding.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, service string, spans []SpanData) error {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "comfy-service-tests"
+	for _, span := range spans {
+		entry := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              int(span.Kind),
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.ParentID.IsValid() {
+			entry.ParentSpanID = span.ParentID.String()
+		}
+		if span.Error != "" {
+			entry.Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		scope.Spans = append(scope.Spans, entry)
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = otlpAttributes(map[string]any{"service.name": service})
+	payload, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func otlpAttributes(attrs map[string]any) []otlpAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, key := range keys {
+		var value otlpValue
+		switch v := attrs[key].(type) {
+		case bool:
+			value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int32:
+			s := strconv.FormatInt(int64(v), 10)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		out = append(out, otlpAttribute{Key: key, Value: value})
+	}
+	return out
+}
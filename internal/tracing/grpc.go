@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Inject copies the active span context into outgoing gRPC metadata.
+func Inject(ctx context.Context) context.Context {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, TraceparentHeader, sc.Traceparent())
+}
+
+// Extract reads a span context from incoming gRPC metadata.
+func Extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	values := md.Get(TraceparentHeader)
+	if len(values) == 0 {
+		return ctx
+	}
+	sc, err := ParseTraceparent(values[0])
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// healthMethodPrefix is the grpc.health.v1 service. Probes and the stage
+// monitor poll it every few seconds, so its calls are not traced.
+const healthMethodPrefix = "/grpc.health.v1.Health/"
+
+func untracedMethod(method string) bool {
+	return strings.HasPrefix(method, healthMethodPrefix)
+}
+
+// UnaryServerInterceptor continues the caller's trace and wraps the handler in a server span.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if untracedMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, span := StartWithKind(Extract(ctx), info.FullMethod, SpanKindServer)
+		defer span.End()
+		resp, err := handler(ctx, req)
+		if err != nil {
+			span.SetAttribute("rpc.grpc.status_code", status.Code(err).String())
+			span.RecordError(err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor continues the caller's trace for streaming RPCs.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if untracedMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, span := StartWithKind(Extract(ss.Context()), info.FullMethod, SpanKindServer)
+		defer span.End()
+		err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+		span.RecordError(err)
+		return err
+	}
+}
+
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryClientInterceptor emits a client span and propagates it to the callee.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if untracedMethod(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, span := StartWithKind(ctx, method, SpanKindClient)
+		defer span.End()
+		err := invoker(Inject(ctx), method, req, reply, cc, opts...)
+		span.RecordError(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor propagates the trace to streaming calls.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if untracedMethod(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		ctx, span := StartWithKind(ctx, method, SpanKindClient)
+		defer span.End()
+		stream, err := streamer(Inject(ctx), desc, cc, method, opts...)
+		span.RecordError(err)
+		return stream, err
+	}
+}
@@ -0,0 +1,29 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// probePaths are liveness and readiness endpoints, polled too often to trace.
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// Middleware continues an incoming traceparent, or starts a new trace, for
+// each request other than health probes.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if sc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = ContextWithSpanContext(ctx, sc)
+		}
+		ctx, span := StartWithKind(ctx, r.Method+" "+r.URL.Path, SpanKindServer)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		w.Header().Set(TraceparentHeader, span.SpanContext().Traceparent())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
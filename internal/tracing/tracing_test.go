@@ -0,0 +1,210 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error { return nil }
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	_, span := Start(context.Background(), "root")
+	sc := span.SpanContext()
+
+	parsed, err := ParseTraceparent(sc.Traceparent())
+	if err != nil {
+		t.Fatalf("parse traceparent: %v", err)
+	}
+	if parsed != sc {
+		t.Fatalf("round trip mismatch: %+v vs %+v", parsed, sc)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-abc-def-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestStartInheritsParent(t *testing.T) {
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+
+	if child.SpanContext().TraceID != parent.SpanContext().TraceID {
+		t.Fatalf("child should share trace id")
+	}
+	if child.parent != parent.SpanContext().SpanID {
+		t.Fatalf("child should reference parent span id")
+	}
+	if TraceIDFromContext(ctx) != parent.SpanContext().TraceID.String() {
+		t.Fatalf("unexpected trace id in context")
+	}
+}
+
+func TestGRPCMetadataPropagation(t *testing.T) {
+	ctx, span := Start(context.Background(), "client")
+	outgoing := Inject(ctx)
+
+	md, ok := metadata.FromOutgoingContext(outgoing)
+	if !ok {
+		t.Fatalf("expected outgoing metadata")
+	}
+	incoming := Extract(metadata.NewIncomingContext(context.Background(), md))
+
+	if got := SpanContextFromContext(incoming); got != span.SpanContext() {
+		t.Fatalf("propagated context mismatch: %+v vs %+v", got, span.SpanContext())
+	}
+}
+
+func TestWriterExporterViaProvider(t *testing.T) {
+	out := &bufferCloser{}
+	provider := NewProvider("test", NewWriterExporter(out))
+	SetProvider(provider)
+	defer SetProvider(nil)
+
+	ctx, parent := Start(context.Background(), "job")
+	_, child := Start(ctx, "attempt")
+	child.SetAttribute("stage.attempt", 2)
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 spans, got %d: %s", len(lines), out.String())
+	}
+	var first jsonSpan
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("decode span: %v", err)
+	}
+	if first.Name != "attempt" || first.Error != "boom" || first.ParentID != parent.SpanContext().SpanID.String() {
+		t.Fatalf("unexpected span: %+v", first)
+	}
+	if first.Service != "test" {
+		t.Fatalf("unexpected service: %s", first.Service)
+	}
+
+	// Setup returns a nil provider when tracing is disabled.
+	var disabled *Provider
+	if err := disabled.Shutdown(context.Background()); err != nil {
+		t.Fatalf("nil provider shutdown: %v", err)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var received otlpRequest
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("decode otlp: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL+"/v1/traces", map[string]string{"Authorization": "Bearer token"})
+	_, span := Start(context.Background(), "export")
+	span.SetAttribute("job.id", "wf-1")
+	span.End()
+
+	data := SpanData{Name: "export", Kind: SpanKindServer, TraceID: span.SpanContext().TraceID, SpanID: span.SpanContext().SpanID, Attributes: map[string]any{"job.id": "wf-1"}}
+	if err := exporter.ExportSpans(context.Background(), "gateway", []SpanData{data}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	if auth != "Bearer token" {
+		t.Fatalf("expected header to be forwarded, got %q", auth)
+	}
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload: %+v", received)
+	}
+	got := received.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if got.TraceID != data.TraceID.String() || got.Kind != int(SpanKindServer) || got.Name != "export" {
+		t.Fatalf("unexpected span: %+v", got)
+	}
+	service := received.ResourceSpans[0].Resource.Attributes[0]
+	if service.Key != "service.name" || service.Value.StringValue == nil || *service.Value.StringValue != "gateway" {
+		t.Fatalf("unexpected resource: %+v", service)
+	}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = TraceIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/jobs", nil)
+	req.Header.Set(TraceparentHeader, parent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if seen != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected trace id: %s", seen)
+	}
+}
+
+func TestHealthProbesAreNotTraced(t *testing.T) {
+	out := &bufferCloser{}
+	provider := NewProvider("test", NewWriterExporter(out))
+	SetProvider(provider)
+	defer SetProvider(nil)
+
+	server := UnaryServerInterceptor()
+	client := UnaryClientInterceptor()
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	for _, method := range []string{"/grpc.health.v1.Health/Check", "/orchestrator.v1.Orchestrator/ExecuteWorkflow"} {
+		if _, err := server(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler); err != nil {
+			t.Fatalf("server %s: %v", method, err)
+		}
+		if err := client(context.Background(), method, nil, nil, nil, invoker); err != nil {
+			t.Fatalf("client %s: %v", method, err)
+		}
+	}
+	middleware := Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for _, path := range []string{"/readyz", "/healthz", "/v1/jobs"} {
+		middleware.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected spans for the workflow call and /v1/jobs only, got %d: %s", len(lines), out.String())
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "Health/") || strings.Contains(line, "/readyz") || strings.Contains(line, "/healthz") {
+			t.Fatalf("unexpected probe span: %s", line)
+		}
+	}
+}
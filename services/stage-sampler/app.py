@@ -1,21 +1,35 @@
+import contextvars
 import logging
 import os
+import signal
 import sys
+import threading
 import time
 import types
 from concurrent import futures
 
 import grpc
+from grpc_health.v1 import health, health_pb2, health_pb2_grpc
 
 import orchestrator_pb2
 import orchestrator_pb2_grpc
 from app_core import (
  build_metadata,
+ build_png_text,
  clamp_dim,
  detect_kind,
+ file_digest,
+ format_job_log_line,
+ grpc_tls_settings,
+ is_valid_job_id,
+ job_log_path,
  parse_float,
+ parse_duration,
  parse_int,
+ peer_allowed,
+ clamp_quality,
  resolve_checkpoint,
+ resolve_output_format,
  write_metadata,
 )
 
@@ -27,8 +41,47 @@ TORCH_DEVICE = os.getenv("TORCH_DEVICE", "cpu")
 TORCH_DTYPE = os.getenv("TORCH_DTYPE", "float32")
 LOG_DIR = os.getenv("LOG_DIR", "/logs")
 MAX_CHECKPOINT_BYTES = int(os.getenv("MAX_CHECKPOINT_BYTES", "0"))
+GRPC_TLS = grpc_tls_settings(os.environ)
+STAGE_RUNNER_SERVICE = orchestrator_pb2.DESCRIPTOR.services_by_name["StageRunner"].full_name
+# One pipeline renders at a time. The server has spare worker threads so
+# health checks are answered while a stage runs.
+STAGE_LOCK = threading.Lock()
+# Seconds SIGTERM waits for a running stage before the server stops.
+DRAIN_TIMEOUT = parse_duration(os.getenv("DRAIN_TIMEOUT", ""), 120.0)
 
 logger = logging.getLogger("stage-sampler")
+# Job whose stage is running on this thread; its records are teed to job.log.
+CURRENT_JOB = contextvars.ContextVar("current_job", default="")
+
+
+class JobLogHandler(logging.Handler):
+    """Appends records logged during a stage to <artifacts>/<job-id>/job.log.
+
+    The Go services write the same file in the same line format, so the
+    gateway serves one interleaved log per job.
+    """
+
+    def __init__(self, service: str, artifacts_root: str) -> None:
+        super().__init__()
+        self.service = service
+        self.artifacts_root = artifacts_root
+
+    def emit(self, record: logging.LogRecord) -> None:
+        job_id = CURRENT_JOB.get()
+        if not job_id:
+            return
+        attrs = [("service", self.service), ("job_id", job_id)]
+        if record.exc_info and record.exc_info[1] is not None:
+            attrs.append(("err", format_error(record.exc_info[1])))
+        try:
+            path = job_log_path(self.artifacts_root, job_id)
+            line = format_job_log_line(record.created, record.levelname, record.getMessage(), attrs)
+            os.makedirs(os.path.dirname(path), exist_ok=True)
+            with open(path, "a", encoding="utf-8") as handle:
+                handle.write(line)
+        except (OSError, ValueError):
+            # Like the Go sink: a job log that cannot be written is skipped.
+            return
 
 
 def setup_logging() -> None:
@@ -53,6 +106,8 @@ def setup_logging() -> None:
 
     logger.addHandler(file_handler)
     logger.addHandler(stream_handler)
+    if ARTIFACTS_ROOT:
+        logger.addHandler(JobLogHandler("stage-sampler", ARTIFACTS_ROOT))
     logger.info("logging initialized log_path=%s", log_path)
 
 
@@ -132,6 +187,16 @@ def parse_dtype(value: str, device: str):
     return torch.float32
 
 
+def build_pnginfo(params):
+    from PIL import PngImagePlugin
+
+    info = PngImagePlugin.PngInfo()
+    for key, value in build_png_text(params):
+        # Pillow writes tEXt for Latin-1 text and falls back to iTXt otherwise.
+        info.add_text(key, value)
+    return info
+
+
 def format_error(exc: Exception) -> str:
     message = str(exc)
     name = type(exc).__name__
@@ -226,6 +291,31 @@ def apply_scheduler(pipe, sampler: str):
 
 class StageRunner(orchestrator_pb2_grpc.StageRunnerServicer):
     def RunStage(self, request, context):
+        token = CURRENT_JOB.set(request.stage_id)
+        try:
+            with STAGE_LOCK:
+                start = time.monotonic()
+                logger.info("stage started id=%s", request.stage_id)
+                result = self._run_stage(request, context)
+                duration = time.monotonic() - start
+                if result.status == "completed":
+                    logger.info("stage completed id=%s duration=%.3fs", request.stage_id, duration)
+                else:
+                    logger.error(
+                        "stage failed id=%s duration=%.3fs err=%s",
+                        request.stage_id,
+                        duration,
+                        result.error_message,
+                    )
+                return result
+        finally:
+            CURRENT_JOB.reset(token)
+
+    def _run_stage(self, request, context):
+        if not peer_allowed(context.auth_context(), GRPC_TLS["allowed_clients"]):
+            context.abort(grpc.StatusCode.PERMISSION_DENIED, "client certificate not allowed")
+        if not is_valid_job_id(request.stage_id):
+            context.abort(grpc.StatusCode.INVALID_ARGUMENT, "invalid job id")
         requested_checkpoint = request.params.get("checkpoint", "")
         try:
             checkpoint = resolve_checkpoint(
@@ -246,6 +336,17 @@ class StageRunner(orchestrator_pb2_grpc.StageRunnerServicer):
         steps = parse_int(request.params.get("steps", "20"), 20)
         cfg = parse_float(request.params.get("cfg", "8"), 8.0)
         seed = parse_int(request.params.get("seed", "0"), 0)
+        quality = clamp_quality(parse_int(request.params.get("quality", "0"), 0))
+        try:
+            extension, image_format, content_type = resolve_output_format(
+                request.params.get("format", "")
+            )
+        except ValueError as exc:
+            return orchestrator_pb2.StageResult(
+                stage_id=request.stage_id,
+                status="failed",
+                error_message=str(exc),
+            )
 
         params = dict(request.params)
         try:
@@ -292,9 +393,15 @@ class StageRunner(orchestrator_pb2_grpc.StageRunnerServicer):
         output_dir = os.path.join(ARTIFACTS_ROOT, request.stage_id)
         os.makedirs(output_dir, exist_ok=True)
 
-        output_path = os.path.join(output_dir, "output.png")
+        output_name = f"output.{extension}"
+        output_path = os.path.join(output_dir, output_name)
         try:
-            result.images[0].save(output_path)
+            save_options = {}
+            if image_format == "PNG":
+                save_options["pnginfo"] = build_pnginfo(params)
+            else:
+                save_options["quality"] = quality
+            result.images[0].save(output_path, format=image_format, **save_options)
         except Exception as exc:
             error_message = format_error(exc)
             logger.exception("failed to save output: %s", error_message)
@@ -319,9 +426,11 @@ class StageRunner(orchestrator_pb2_grpc.StageRunnerServicer):
         logger.info("job completed id=%s output=%s", request.stage_id, output_path)
 
         output_ref = orchestrator_pb2.TensorRef(
-            uri=output_path,
+            uri=f"artifact://{request.stage_id}/{output_name}",
             shape=[height, width, 3],
-            dtype="image/png",
+            dtype=content_type,
+            digest=file_digest(output_path),
+            size_bytes=os.path.getsize(output_path),
         )
 
         return orchestrator_pb2.StageResult(
@@ -334,6 +443,26 @@ class StageRunner(orchestrator_pb2_grpc.StageRunnerServicer):
         return orchestrator_pb2.HealthResponse(status="ok")
 
 
+def read_file(path: str) -> bytes:
+    with open(path, "rb") as handle:
+        return handle.read()
+
+
+def server_credentials(settings):
+    """TLS credentials for the listener, or None for plaintext."""
+    if not (settings["cert"] or settings["key"] or settings["ca"]):
+        return None
+    if not (settings["cert"] and settings["key"]):
+        raise ValueError("GRPC_TLS_CERT and GRPC_TLS_KEY are required for TLS")
+    if settings["client_auth"] and not settings["ca"]:
+        raise ValueError("GRPC_TLS_CA is required for client authentication")
+    return grpc.ssl_server_credentials(
+        [(read_file(settings["key"]), read_file(settings["cert"]))],
+        root_certificates=read_file(settings["ca"]) if settings["ca"] else None,
+        require_client_auth=settings["client_auth"],
+    )
+
+
 def serve() -> None:
     setup_logging()
     if not os.path.isdir(CHECKPOINTS_DIR):
@@ -343,11 +472,30 @@ def serve() -> None:
         ARTIFACTS_ROOT,
         CHECKPOINTS_DIR,
     )
-    server = grpc.server(futures.ThreadPoolExecutor(max_workers=1))
+    server = grpc.server(futures.ThreadPoolExecutor(max_workers=4))
     orchestrator_pb2_grpc.add_StageRunnerServicer_to_server(StageRunner(), server)
-    server.add_insecure_port("[::]:9091")
+    health_servicer = health.HealthServicer(experimental_non_blocking=True)
+    health_pb2_grpc.add_HealthServicer_to_server(health_servicer, server)
+    for service in ("", STAGE_RUNNER_SERVICE):
+        health_servicer.set(service, health_pb2.HealthCheckResponse.SERVING)
+    credentials = server_credentials(GRPC_TLS)
+    if credentials is None:
+        server.add_insecure_port("[::]:9091")
+    else:
+        logger.info("grpc tls enabled client_auth=%s", GRPC_TLS["client_auth"])
+        server.add_secure_port("[::]:9091", credentials)
     server.start()
+
+    def stop(signum, _frame):
+        # Refuse new stages and give the running one up to DRAIN_TIMEOUT.
+        logger.info("stopping stage-sampler signal=%s grace=%ss", signum, DRAIN_TIMEOUT)
+        health_servicer.enter_graceful_shutdown()
+        server.stop(DRAIN_TIMEOUT)
+
+    signal.signal(signal.SIGTERM, stop)
+    signal.signal(signal.SIGINT, stop)
     server.wait_for_termination()
+    logger.info("stage-sampler stopped")
 
 
 if __name__ == "__main__":
@@ -1,6 +1,72 @@
+import hashlib
 import json
 import os
-from typing import Dict
+import re
+from datetime import datetime, timezone
+from typing import Dict, List, Tuple
+
+
+JOB_ID_PATTERN = re.compile(r"^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$")
+
+
+def is_valid_job_id(value: str) -> bool:
+    return bool(JOB_ID_PATTERN.fullmatch(value or ""))
+
+
+JOB_LOG_NAME = "job.log"
+
+# Python level names as Go's slog prints them.
+SLOG_LEVELS = {
+    "DEBUG": "DEBUG",
+    "INFO": "INFO",
+    "WARNING": "WARN",
+    "ERROR": "ERROR",
+    "CRITICAL": "ERROR",
+}
+
+
+def job_log_path(artifacts_root: str, job_id: str) -> str:
+    if not is_valid_job_id(job_id):
+        raise ValueError(f"invalid job id: {job_id!r}")
+    return os.path.join(artifacts_root, job_id, JOB_LOG_NAME)
+
+
+def logfmt_value(value: str) -> str:
+    if value and not any(ch.isspace() or ch in '="' or not ch.isprintable() for ch in value):
+        return value
+    return json.dumps(value, ensure_ascii=False)
+
+
+def format_job_log_line(created: float, level: str, message: str, attrs: List[Tuple[str, str]]) -> str:
+    """Render a job.log line the way the Go services' slog text handler does."""
+    when = datetime.fromtimestamp(created, timezone.utc).isoformat(timespec="milliseconds")
+    fields = [("time", when.replace("+00:00", "Z")), ("level", SLOG_LEVELS.get(level, level)), ("msg", message)]
+    fields.extend(attrs)
+    return " ".join(f"{key}={logfmt_value(str(value))}" for key, value in fields) + "\n"
+
+
+# format widget value -> (file extension, PIL format, content type)
+OUTPUT_FORMATS = {
+    "png": ("png", "PNG", "image/png"),
+    "jpg": ("jpg", "JPEG", "image/jpeg"),
+    "jpeg": ("jpg", "JPEG", "image/jpeg"),
+    "webp": ("webp", "WEBP", "image/webp"),
+}
+
+DEFAULT_QUALITY = 90
+
+
+def resolve_output_format(name: str) -> Tuple[str, str, str]:
+    key = (name or "png").strip().lower()
+    if key not in OUTPUT_FORMATS:
+        raise ValueError(f"unsupported image format: {name!r}")
+    return OUTPUT_FORMATS[key]
+
+
+def clamp_quality(value: int) -> int:
+    if value <= 0:
+        return DEFAULT_QUALITY
+    return min(value, 100)
 
 
 def resolve_checkpoint(name: str, checkpoints_dir: str, default_checkpoint: str) -> str:
@@ -38,6 +104,24 @@ def parse_float(value: str, fallback: float) -> float:
         return fallback
 
 
+_DURATION_UNITS = {"ms": 0.001, "s": 1.0, "m": 60.0, "h": 3600.0}
+
+
+def parse_duration(value: str, fallback: float) -> float:
+    """Parses seconds from plain numbers or Go-style durations like "90s", "2m" or "1m30s"."""
+    text = (value or "").strip()
+    if not text:
+        return fallback
+    try:
+        return float(text)
+    except ValueError:
+        pass
+    parts = re.findall(r"(\d+(?:\.\d+)?)(ms|s|m|h)", text)
+    if not parts or "".join(number + unit for number, unit in parts) != text:
+        return fallback
+    return sum(float(number) * _DURATION_UNITS[unit] for number, unit in parts)
+
+
 def clamp_dim(value: int) -> int:
     if value < 64:
         value = 64
@@ -56,6 +140,68 @@ def build_metadata(params: Dict[str, str]) -> Dict[str, str]:
     }
 
 
+# PNG text keywords, in the order they are embedded. "prompt" and "workflow"
+# carry the API- and UI-format graphs ComfyUI restores on drag-and-drop.
+PNG_TEXT_KEYS = (
+    "prompt",
+    "workflow",
+    "positive",
+    "negative",
+    "checkpoint",
+    "seed",
+    "steps",
+    "cfg",
+    "sampler",
+    "scheduler",
+)
+
+
+def build_png_text(params: Dict[str, str]) -> List[Tuple[str, str]]:
+    return [(key, params[key]) for key in PNG_TEXT_KEYS if params.get(key)]
+
+
 def write_metadata(path: str, metadata: Dict[str, str]):
     with open(path, "w", encoding="utf-8") as handle:
         json.dump(metadata, handle, indent=2)
+
+
+def file_digest(path: str) -> str:
+    digest = hashlib.sha256()
+    with open(path, "rb") as handle:
+        for chunk in iter(lambda: handle.read(1 << 20), b""):
+            digest.update(chunk)
+    return "sha256:" + digest.hexdigest()
+
+
+def grpc_tls_settings(env: Dict[str, str]) -> Dict[str, object]:
+    """Reads the GRPC_TLS_* variables shared with the Go services."""
+    allowed = [
+        name.strip()
+        for name in env.get("GRPC_TLS_ALLOWED_CLIENTS", "").split(",")
+        if name.strip()
+    ]
+    client_auth = env.get("GRPC_TLS_CLIENT_AUTH", "").strip().lower() in ("1", "t", "true", "yes")
+    return {
+        "cert": env.get("GRPC_TLS_CERT", ""),
+        "key": env.get("GRPC_TLS_KEY", ""),
+        "ca": env.get("GRPC_TLS_CA", ""),
+        "server_name": env.get("GRPC_TLS_SERVER_NAME", ""),
+        "client_auth": client_auth or bool(allowed),
+        "allowed_clients": allowed,
+    }
+
+
+def peer_allowed(auth_context: Dict[str, List[bytes]], allowed: List[str]) -> bool:
+    """Matches a gRPC auth context's certificate names against an allowlist."""
+    if not allowed:
+        return True
+    wanted = {name.lower() for name in allowed}
+    names = list(auth_context.get("x509_common_name", [])) + list(
+        auth_context.get("x509_subject_alternative_name", [])
+    )
+    for name in names:
+        if isinstance(name, bytes):
+            name = name.decode("utf-8", "replace")
+        if name.lower() in wanted:
+            return True
+    return False
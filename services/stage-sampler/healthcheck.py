@@ -1,16 +1,43 @@
+import os
 import sys
 
 import grpc
+from grpc_health.v1 import health_pb2, health_pb2_grpc
 
 import orchestrator_pb2
-import orchestrator_pb2_grpc
+from app_core import grpc_tls_settings
+
+
+def open_channel(target: str) -> grpc.Channel:
+    settings = grpc_tls_settings(os.environ)
+    if not (settings["cert"] or settings["ca"]):
+        return grpc.insecure_channel(target)
+
+    def read(path: str):
+        if not path:
+            return None
+        with open(path, "rb") as handle:
+            return handle.read()
+
+    credentials = grpc.ssl_channel_credentials(
+        root_certificates=read(settings["ca"]),
+        private_key=read(settings["key"]),
+        certificate_chain=read(settings["cert"]),
+    )
+    # The probe dials 127.0.0.1; verify against a name the certificate carries.
+    name = settings["server_name"] or "localhost"
+    return grpc.secure_channel(target, credentials, options=[("grpc.ssl_target_name_override", name)])
 
 
 def main() -> int:
     try:
-        channel = grpc.insecure_channel("127.0.0.1:9091")
-        stub = orchestrator_pb2_grpc.StageRunnerStub(channel)
-        stub.Health(orchestrator_pb2.HealthRequest(), timeout=2.0)
+        channel = open_channel("127.0.0.1:9091")
+        stub = health_pb2_grpc.HealthStub(channel)
+        service = orchestrator_pb2.DESCRIPTOR.services_by_name["StageRunner"].full_name
+        resp = stub.Check(health_pb2.HealthCheckRequest(service=service), timeout=2.0)
+        if resp.status != health_pb2.HealthCheckResponse.SERVING:
+            print(f"stage-sampler is {health_pb2.HealthCheckResponse.ServingStatus.Name(resp.status)}", file=sys.stderr)
+            return 1
         return 0
     except Exception as exc:
         print(f"stage-sampler healthcheck failed: {exc}", file=sys.stderr)
@@ -53,3 +53,87 @@ def test_metadata_write(tmp_path: Path):
     loaded = json.loads(path.read_text())
     assert loaded["checkpoint"] == "foo"
     assert loaded["steps"] == "20"
+
+
+def test_file_digest(tmp_path: Path):
+    path = tmp_path / "output.png"
+    path.write_bytes(b"abc")
+    assert app_core.file_digest(str(path)) == (
+        "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+    )
+
+
+def test_is_valid_job_id():
+    assert app_core.is_valid_job_id("wf-1729000000000000000")
+    for bad in ["", "..", "../../etc", "a/b", "a\\b", "-x", "a.b", "x" * 65]:
+        assert not app_core.is_valid_job_id(bad)
+
+
+def test_resolve_output_format():
+    assert app_core.resolve_output_format("") == ("png", "PNG", "image/png")
+    assert app_core.resolve_output_format("JPEG") == ("jpg", "JPEG", "image/jpeg")
+    assert app_core.resolve_output_format("webp")[2] == "image/webp"
+    with pytest.raises(ValueError):
+        app_core.resolve_output_format("gif")
+    assert app_core.clamp_quality(0) == app_core.DEFAULT_QUALITY
+    assert app_core.clamp_quality(150) == 100
+
+
+def test_build_png_text():
+    params = {"positive": "cat", "seed": "7", "workflow": '{"nodes": []}', "negative": ""}
+    assert app_core.build_png_text(params) == [
+        ("workflow", '{"nodes": []}'),
+        ("positive", "cat"),
+        ("seed", "7"),
+    ]
+
+
+def test_grpc_tls_settings():
+    assert app_core.grpc_tls_settings({})["client_auth"] is False
+    settings = app_core.grpc_tls_settings(
+        {
+            "GRPC_TLS_CERT": "/certs/stage-sampler.pem",
+            "GRPC_TLS_ALLOWED_CLIENTS": "orchestrator, ",
+        }
+    )
+    assert settings["cert"] == "/certs/stage-sampler.pem"
+    assert settings["allowed_clients"] == ["orchestrator"]
+    assert settings["client_auth"] is True
+    assert app_core.grpc_tls_settings({"GRPC_TLS_CLIENT_AUTH": "true"})["client_auth"] is True
+
+
+def test_job_log_line_matches_slog_text():
+    line = app_core.format_job_log_line(
+        0.25,
+        "WARNING",
+        "stage failed",
+        [("service", "stage-sampler"), ("job_id", "wf-9"), ("err", 'bad "value"')],
+    )
+    assert line == (
+        'time=1970-01-01T00:00:00.250Z level=WARN msg="stage failed" '
+        'service=stage-sampler job_id=wf-9 err="bad \\"value\\""\n'
+    )
+    assert app_core.job_log_path("/artifacts", "wf-9") == "/artifacts/wf-9/job.log"
+    with pytest.raises(ValueError):
+        app_core.job_log_path("/artifacts", "../etc")
+
+
+def test_parse_duration():
+    assert app_core.parse_duration("90", 5) == 90
+    assert app_core.parse_duration("2m", 5) == 120
+    assert app_core.parse_duration("1m30s", 5) == 90
+    assert app_core.parse_duration("250ms", 5) == 0.25
+    assert app_core.parse_duration("", 5) == 5
+    assert app_core.parse_duration("soon", 5) == 5
+    assert app_core.parse_duration("2m later", 5) == 5
+
+
+def test_peer_allowed():
+    context = {
+        "x509_common_name": [b"orchestrator"],
+        "x509_subject_alternative_name": [b"orchestrator", b"localhost"],
+    }
+    assert app_core.peer_allowed(context, [])
+    assert app_core.peer_allowed(context, ["Orchestrator"])
+    assert not app_core.peer_allowed(context, ["gateway"])
+    assert not app_core.peer_allowed({}, ["orchestrator"])